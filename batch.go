@@ -0,0 +1,160 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A Registration is a pending registration of a struct type, for use with RegisterBatch.
+type Registration struct {
+	typ  reflect.Type
+	opts []Option
+}
+
+// Type returns a Registration of T with opts.
+func Type[T any](opts ...Option) Registration {
+	var t T
+	return TypeOf(reflect.TypeOf(t), opts...)
+}
+
+// TypeOf returns a Registration of typ with opts, as AddFuncMapType would register it.
+func TypeOf(typ reflect.Type, opts ...Option) Registration {
+	return Registration{typ: typ, opts: opts}
+}
+
+// RegisterBatch registers many types at once, as if by Register.
+// Either all types are registered, or none are.
+// If registering any type would cause a conflict, RegisterBatch returns a *ConflictError
+// describing every conflict among regs and the types already in r.
+func (r *Registry) RegisterBatch(regs ...Registration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.state().clone()
+	err := st.registerBatch(regs)
+	if err != nil {
+		return err
+	}
+	r.st = st
+	return nil
+}
+
+// AddFuncMapBatch is like RegisterBatch, but adds the types to base, as AddFuncMap does.
+// If AddFuncMapBatch returns a non-nil error, base will be unmodified.
+func AddFuncMapBatch(base map[string]any, regs ...Registration) error {
+	if base == nil {
+		return fmt.Errorf("base FuncMap is nil")
+	}
+	st := loadFuncMap(base)
+	err := st.registerBatch(regs)
+	if err != nil {
+		return err
+	}
+	// Nothing went wrong; copy the new entries back onto base.
+	st.writeFuncMap(base)
+	return nil
+}
+
+// registerBatch registers regs with st, collecting all conflicts.
+// If it returns a non-nil error, st must be discarded.
+func (st *registryState) registerBatch(regs []Registration) error {
+	var conflicts []Conflict
+	st.conflicts = &conflicts
+	st.conflicted = make(map[reflect.Type]bool)
+	defer func() { st.conflicts, st.conflicted = nil, nil }()
+	for _, reg := range regs {
+		err := registerType(st, reg.typ, reg.opts)
+		if err != nil {
+			return err
+		}
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// A Conflict is a FuncMap name with several competing uses.
+type Conflict struct {
+	Name  string
+	Uses  []string       // descriptions of the competing uses, such as "the constructor for api.User"
+	Types []reflect.Type // the struct types (for constructors and setters) and func types (for other entries) involved
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s is %s", c.Name, strings.Join(c.Uses, " and "))
+}
+
+// A ConflictError reports conflicting FuncMap entries.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	var b strings.Builder
+	b.WriteString("conflicting FuncMap entries: ")
+	for i, c := range e.Conflicts {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(c.String())
+	}
+	return b.String()
+}
+
+// conflict handles a new use of name, which is already in use in st.
+// use describes the new use, by struct type typ, and err is the error to report for it.
+// If st is collecting conflicts, conflict records it and returns nil; the new use must be skipped,
+// but registration should continue, to find any further conflicts.
+// Otherwise, it returns err.
+func (st *registryState) conflict(name, use string, typ reflect.Type, err error) error {
+	if st.conflicts == nil {
+		return err
+	}
+	*st.conflicts = append(*st.conflicts, Conflict{
+		Name:  name,
+		Uses:  []string{st.describe(name), use},
+		Types: append(st.typesOf(name), typ),
+	})
+	return nil
+}
+
+// describe describes the entry named name in st, for use in conflict reports.
+func (st *registryState) describe(name string) string {
+	if st.generic && isGenericName(name) {
+		return "the generic func " + name
+	}
+	if info, ok := st.ctors[name]; ok {
+		return fmt.Sprintf("the constructor for %v", info.typ)
+	}
+	if t, ok := st.setters[name]; ok {
+		types := make([]string, len(t.entries))
+		for i, e := range t.entries {
+			types[i] = e.typ.String()
+		}
+		return fmt.Sprintf("a field setter for %s", strings.Join(types, ", "))
+	}
+	if x, ok := st.others[name]; ok {
+		return fmt.Sprintf("a %T", x)
+	}
+	return "unused"
+}
+
+// typesOf returns the types involved in the entry named name in st:
+// the struct types of constructors and setters, and the types of other entries.
+func (st *registryState) typesOf(name string) []reflect.Type {
+	if info, ok := st.ctors[name]; ok {
+		return []reflect.Type{info.typ}
+	}
+	if t, ok := st.setters[name]; ok {
+		types := make([]reflect.Type, len(t.entries))
+		for i, e := range t.entries {
+			types[i] = e.typ
+		}
+		return types
+	}
+	if x, ok := st.others[name]; ok {
+		return []reflect.Type{reflect.TypeOf(x)}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package tstruct_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+func TestRegisterBatch(t *testing.T) {
+	type A struct{ Name string }
+	type B struct{ Name int }
+	m := template.FuncMap{}
+	err := tstruct.AddFuncMapBatch(m, tstruct.Type[A](), tstruct.Type[B](), tstruct.Type[*Route](tstruct.Name("Rt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range tstruct.FromFuncMap(m).Structs() {
+		names = append(names, s.Name)
+	}
+	if want := []string{"A", "B", "Backend", "Rt"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+}
+
+func TestRegisterBatchConflicts(t *testing.T) {
+	type Name struct{}
+	type A struct{ Name string }
+	type Port struct{ Addr int }
+	r := tstruct.NewRegistry()
+	if err := tstruct.Register[Listener](r); err != nil {
+		t.Fatal(err)
+	}
+	before := r.FuncMap()
+	err := r.RegisterBatch(tstruct.Type[A](), tstruct.Type[Name](), tstruct.Type[Backend](), tstruct.Type[Port]())
+	var cerr *tstruct.ConflictError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected *ConflictError, got %v", err)
+	}
+	var got []string
+	for _, c := range cerr.Conflicts {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"Name is a field setter for tstruct_test.A and the constructor for tstruct_test.Name",
+		"Port is a field setter for tstruct_test.Listener and the constructor for tstruct_test.Port",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got conflicts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	nameType := reflect.TypeOf(Name{})
+	if types := cerr.Conflicts[0].Types; !reflect.DeepEqual(types, []reflect.Type{reflect.TypeOf(A{}), nameType}) {
+		t.Errorf("got types %v", types)
+	}
+	// Nothing was registered, not even the types without conflicts.
+	if after := r.FuncMap(); len(after) != len(before) {
+		t.Errorf("failed batch modified the Registry: %d entries, was %d", len(after), len(before))
+	}
+}
+
+func TestRegisterBatchConflictsWithinConflictingType(t *testing.T) {
+	type Weight struct{ Unit string }
+	type Port struct {
+		Listener string
+		W        Weight
+		Ws       []Weight
+	}
+	r := tstruct.NewRegistry()
+	if err := r.RegisterBatch(tstruct.Type[Listener](), tstruct.Type[Backend]()); err != nil {
+		t.Fatal(err)
+	}
+	// Port's constructor conflicts, and so do its setter Listener and its nested type Weight.
+	err := r.RegisterBatch(tstruct.Type[Port]())
+	var cerr *tstruct.ConflictError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected *ConflictError, got %v", err)
+	}
+	var got []string
+	for _, c := range cerr.Conflicts {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"Port is a field setter for tstruct_test.Listener and the constructor for tstruct_test.Port",
+		"Listener is the constructor for tstruct_test.Listener and a field setter for tstruct_test.Port",
+		"Weight is a field setter for tstruct_test.Backend and the constructor for tstruct_test.Weight",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got conflicts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAddFuncMapBatchConflicts(t *testing.T) {
+	type Pool struct{ Weight float64 }
+	m := template.FuncMap{"Weight": strings.ToUpper}
+	err := tstruct.AddFuncMapBatch(m, tstruct.Type[Backend](), tstruct.Type[Pool]())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	want := "conflicting FuncMap entries: " +
+		"Weight is a func(string) string and a field setter for tstruct_test.Backend; " +
+		"Weight is a func(string) string and a field setter for tstruct_test.Pool"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if len(m) != 1 {
+		t.Errorf("failed batch modified base: %v", m)
+	}
+}
@@ -0,0 +1,184 @@
+package tstruct
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+var (
+	bigIntType   = reflect.TypeOf(big.Int{})
+	bigFloatType = reflect.TypeOf(big.Float{})
+	bigRatType   = reflect.TypeOf(big.Rat{})
+)
+
+// bigType returns the math/big type underlying typ, which is either that type or a pointer to it.
+// It reports false if typ is not a math/big number type.
+func bigType(typ reflect.Type) (reflect.Type, bool) {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case bigIntType, bigFloatType, bigRatType:
+		return typ, true
+	}
+	return nil, false
+}
+
+func isBig(typ reflect.Type) bool {
+	_, ok := bigType(typ)
+	return ok
+}
+
+// canConvertToBig reports whether convertToBig accepts values of type src.
+func canConvertToBig(src reflect.Type) bool {
+	if isBig(src) {
+		return true
+	}
+	switch src.Kind() {
+	case reflect.String, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return isInteger(src.Kind())
+}
+
+func isInteger(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// convertToBig converts src to typ, a math/big number type or pointer to one,
+// for use as (part of) the value of the field named name.
+// Strings are parsed exactly (subject to big.Float precision), without a detour through float64.
+func convertToBig(name string, src reflect.Value, typ reflect.Type) reflect.Value {
+	bt, _ := bigType(typ)
+	var x any
+	var ok bool
+	switch bt {
+	case bigIntType:
+		x, ok = toBigInt(src)
+	case bigFloatType:
+		x, ok = toBigFloat(src)
+	case bigRatType:
+		x, ok = toBigRat(src)
+	}
+	if !ok {
+		panic(fmt.Sprintf("cannot use %v (%v) as %v in %s", src, src.Type(), bt, name))
+	}
+	v := reflect.ValueOf(x)
+	if typ.Kind() != reflect.Pointer {
+		v = v.Elem()
+	}
+	return v
+}
+
+// bigValue returns a pointer to the math/big number in src, which may be a pointer or value.
+func bigValue(src reflect.Value) any {
+	if src.Kind() == reflect.Pointer {
+		return src.Interface()
+	}
+	p := reflect.New(src.Type())
+	p.Elem().Set(src)
+	return p.Interface()
+}
+
+func toBigInt(src reflect.Value) (*big.Int, bool) {
+	switch {
+	case isBig(src.Type()):
+		switch b := bigValue(src).(type) {
+		case *big.Int:
+			return new(big.Int).Set(b), true
+		case *big.Rat:
+			if b.IsInt() {
+				return new(big.Int).Set(b.Num()), true
+			}
+		case *big.Float:
+			if b.IsInt() {
+				i, _ := b.Int(nil)
+				return i, true
+			}
+		}
+		return nil, false
+	case src.CanInt():
+		return big.NewInt(src.Int()), true
+	case src.CanUint():
+		return new(big.Int).SetUint64(src.Uint()), true
+	case src.CanFloat():
+		f := src.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		bf := big.NewFloat(f)
+		if !bf.IsInt() {
+			return nil, false
+		}
+		i, _ := bf.Int(nil)
+		return i, true
+	case src.Kind() == reflect.String:
+		return new(big.Int).SetString(src.String(), 0)
+	}
+	return nil, false
+}
+
+func toBigFloat(src reflect.Value) (*big.Float, bool) {
+	switch {
+	case isBig(src.Type()):
+		switch b := bigValue(src).(type) {
+		case *big.Int:
+			return new(big.Float).SetInt(b), true
+		case *big.Rat:
+			return new(big.Float).SetRat(b), true
+		case *big.Float:
+			return new(big.Float).Copy(b), true
+		}
+	case src.CanInt():
+		return new(big.Float).SetInt64(src.Int()), true
+	case src.CanUint():
+		return new(big.Float).SetUint64(src.Uint()), true
+	case src.CanFloat():
+		f := src.Float()
+		if math.IsNaN(f) {
+			return nil, false
+		}
+		return big.NewFloat(f), true
+	case src.Kind() == reflect.String:
+		// Use enough precision to represent all the digits in the string.
+		s := src.String()
+		prec := uint(64)
+		if p := uint(4 * len(s)); p > prec {
+			prec = p
+		}
+		return new(big.Float).SetPrec(prec).SetString(s)
+	}
+	return nil, false
+}
+
+func toBigRat(src reflect.Value) (*big.Rat, bool) {
+	switch {
+	case isBig(src.Type()):
+		switch b := bigValue(src).(type) {
+		case *big.Int:
+			return new(big.Rat).SetInt(b), true
+		case *big.Rat:
+			return new(big.Rat).Set(b), true
+		case *big.Float:
+			r, _ := b.Rat(nil)
+			return r, r != nil
+		}
+	case src.CanInt():
+		return big.NewRat(src.Int(), 1), true
+	case src.CanUint():
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(src.Uint())), true
+	case src.CanFloat():
+		r := new(big.Rat).SetFloat64(src.Float())
+		return r, r != nil
+	case src.Kind() == reflect.String:
+		return new(big.Rat).SetString(src.String())
+	}
+	return nil, false
+}
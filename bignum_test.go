@@ -0,0 +1,99 @@
+package tstruct_test
+
+import (
+	"io"
+	"math"
+	"math/big"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Ledger struct {
+	Count   big.Int
+	Balance *big.Int
+	Amount  *big.Rat
+	Ratio   big.Rat
+	Rate    *big.Float
+	Entries []*big.Rat
+}
+
+func mustRat(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic(s)
+	}
+	return r
+}
+
+func TestBig(t *testing.T) {
+	balance, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	want := Ledger{
+		Count:   *big.NewInt(3),
+		Balance: balance,
+		Amount:  mustRat("12345678901234567890.01"),
+		Ratio:   *big.NewRat(1, 4),
+		Rate:    big.NewFloat(2),
+		Entries: []*big.Rat{big.NewRat(1, 1), big.NewRat(1, 2), big.NewRat(1, 3)},
+	}
+	const tmpl = `
+{{ yield
+	(Ledger
+		(Count 3)
+		(Balance "123456789012345678901234567890")
+		(Amount "12345678901234567890.01")
+		(Ratio 0.25)
+		(Rate 2)
+		(Entries 1 "0.5" "1/3")
+	)
+}}
+`
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Ledger](m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Int", "Rat", "Float"} {
+		if _, ok := m[name]; ok {
+			t.Errorf("unexpected FuncMap entry %s", name)
+		}
+	}
+	var got Ledger
+	m["yield"] = func(l Ledger) string {
+		got = l
+		return ""
+	}
+	p, err := template.New("test").Funcs(m).Parse(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Execute(io.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count.Cmp(&want.Count) != 0 || got.Balance.Cmp(want.Balance) != 0 ||
+		got.Amount.Cmp(want.Amount) != 0 || got.Ratio.Cmp(&want.Ratio) != 0 || got.Rate.Cmp(want.Rate) != 0 {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(got.Entries) != len(want.Entries) {
+		t.Fatalf("got %v entries, want %v", got.Entries, want.Entries)
+	}
+	for i := range got.Entries {
+		if got.Entries[i].Cmp(want.Entries[i]) != 0 {
+			t.Errorf("entry %d: got %v, want %v", i, got.Entries[i], want.Entries[i])
+		}
+	}
+}
+
+func TestBigErrors(t *testing.T) {
+	testOneWantErrStrs(t, Ledger{}, `{{ yield (Ledger (Balance "12.5")) }}`, []string{"big.Int", "Balance"})
+	testOneWantErrStrs(t, Ledger{}, `{{ yield (Ledger (Balance 1.5)) }}`, []string{"big.Int", "Balance"})
+	testOneWantErrStrs(t, Ledger{}, `{{ yield (Ledger (Amount "x")) }}`, []string{"big.Rat", "Amount"})
+	// Non-finite floats are rejected with the field's name, not a raw math/big panic.
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		testOneWantErrStrs(t, Ledger{}, `{{ yield (Ledger (Balance .)) }}`, []string{"cannot use", "big.Int", "Balance"}, f)
+		testOneWantErrStrs(t, Ledger{}, `{{ yield (Ledger (Amount .)) }}`, []string{"cannot use", "big.Rat", "Amount"}, f)
+	}
+	testOneWantErrStrs(t, Ledger{}, `{{ yield (Ledger (Rate .)) }}`, []string{"cannot use", "big.Float", "Rate"}, math.NaN())
+}
@@ -0,0 +1,80 @@
+package tstruct
+
+import (
+	"reflect"
+	"sort"
+)
+
+// A StructDesc describes a struct type registered for use in templates.
+type StructDesc struct {
+	Type   reflect.Type // the struct type (never a pointer)
+	Name   string       // the constructor name, or, if another type's constructor has it, the qualified Go type name
+	Nested bool         // registered automatically, because another registered type uses it
+	Hidden bool         // only available through New, because the constructor name is in use
+	Fields []FieldDesc  // settable fields, in declaration order
+}
+
+// A FieldDesc describes a settable field of a registered struct type.
+type FieldDesc struct {
+	Field      reflect.StructField // the Go field, including its type and struct tag
+	Name       string              // the setter name
+	Aliases    []string            // additional setter names
+	Required   bool                // tagged "+"
+	Position   int                 // position among the constructor's plain args, or -1
+	Deprecated string              // if non-empty, the Go name of the field set instead of this one
+}
+
+// A SetterDesc describes a setter name and the struct types it dispatches to.
+type SetterDesc struct {
+	Name   string
+	Types  []reflect.Type // in registration order
+	Hidden bool           // only available through Set, because Name is in use
+}
+
+// FromFuncMap returns a new Registry containing the entries in fnmap.
+// Entries added to fnmap by tstruct become registered types and setters;
+// other entries are kept as is, and are included in the Registry's FuncMap.
+func FromFuncMap(fnmap map[string]any) *Registry {
+	return &Registry{st: loadFuncMap(fnmap)}
+}
+
+// Structs describes the struct types registered with r, sorted by constructor name.
+func (r *Registry) Structs() []StructDesc {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.state()
+	descs := make([]StructDesc, 0, len(st.ctors))
+	for name, info := range st.ctors {
+		desc := StructDesc{Type: info.typ, Name: name, Nested: info.nested, Hidden: info.hidden}
+		for _, fi := range info.fields {
+			desc.Fields = append(desc.Fields, FieldDesc{
+				Field:      fi.field,
+				Name:       fi.tag.name,
+				Aliases:    append([]string(nil), fi.tag.aliases...),
+				Required:   fi.tag.required,
+				Position:   fi.tag.pos,
+				Deprecated: fi.tag.deprecated,
+			})
+		}
+		descs = append(descs, desc)
+	}
+	sort.Slice(descs, func(i, j int) bool { return descs[i].Name < descs[j].Name })
+	return descs
+}
+
+// Setters describes the field setters registered with r, sorted by name.
+func (r *Registry) Setters() []SetterDesc {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.state()
+	descs := make([]SetterDesc, 0, len(st.setters))
+	for name, t := range st.setters {
+		desc := SetterDesc{Name: name, Hidden: t.hidden}
+		for _, e := range t.entries {
+			desc.Types = append(desc.Types, e.typ)
+		}
+		descs = append(descs, desc)
+	}
+	sort.Slice(descs, func(i, j int) bool { return descs[i].Name < descs[j].Name })
+	return descs
+}
@@ -0,0 +1,72 @@
+package tstruct_test
+
+import (
+	"reflect"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Route struct {
+	Path   string `tstruct:"pos=0"`
+	To     Backend
+	Weight int `tstruct:"+,alias=W"`
+	Prio   int `tstruct:"deprecated=Weight"`
+}
+
+func TestDescribe(t *testing.T) {
+	m := make(template.FuncMap)
+	m["upper"] = func(s string) string { return s }
+	if err := tstruct.AddFuncMap[Route](m); err != nil {
+		t.Fatal(err)
+	}
+	r := tstruct.FromFuncMap(m)
+
+	structs := r.Structs()
+	if len(structs) != 2 {
+		t.Fatalf("got %d structs, want 2", len(structs))
+	}
+	backend, route := structs[0], structs[1]
+	if backend.Name != "Backend" || backend.Type != reflect.TypeOf(Backend{}) || !backend.Nested {
+		t.Errorf("bad Backend description: %+v", backend)
+	}
+	if route.Name != "Route" || route.Type != reflect.TypeOf(Route{}) || route.Nested {
+		t.Errorf("bad Route description: %+v", route)
+	}
+	var names []string
+	for _, f := range route.Fields {
+		names = append(names, f.Name)
+	}
+	if want := []string{"Path", "To", "Weight", "Prio"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got fields %v, want %v", names, want)
+	}
+	path, weight, prio := route.Fields[0], route.Fields[2], route.Fields[3]
+	if path.Position != 0 || path.Field.Type != reflect.TypeOf("") {
+		t.Errorf("bad Path description: %+v", path)
+	}
+	if !weight.Required || weight.Position != -1 || !reflect.DeepEqual(weight.Aliases, []string{"W"}) || weight.Field.Tag.Get("tstruct") != "+,alias=W" {
+		t.Errorf("bad Weight description: %+v", weight)
+	}
+	if prio.Deprecated != "Weight" {
+		t.Errorf("bad Prio description: %+v", prio)
+	}
+
+	backendType, routeType := reflect.TypeOf(Backend{}), reflect.TypeOf(Route{})
+	want := []tstruct.SetterDesc{
+		{Name: "Addr", Types: []reflect.Type{backendType}},
+		{Name: "Path", Types: []reflect.Type{routeType}},
+		{Name: "Prio", Types: []reflect.Type{routeType}},
+		{Name: "To", Types: []reflect.Type{routeType}},
+		{Name: "W", Types: []reflect.Type{routeType}},
+		{Name: "Weight", Types: []reflect.Type{backendType, routeType}},
+	}
+	if got := r.Setters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got setters %v, want %v", got, want)
+	}
+
+	// Non-tstruct entries are kept.
+	if _, ok := r.FuncMap()["upper"]; !ok {
+		t.Error("FromFuncMap dropped upper")
+	}
+}
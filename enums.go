@@ -0,0 +1,83 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Enum registers names for values of the integer type E,
+// for use by the registration it is passed to.
+// Struct fields of type E (including slice elements and map keys and elems)
+// may then be set by name from a template: (Level "warn").
+// Plain integers continue to work.
+// Enum may be passed more than once for the same type,
+// but the registration fails if a name is reused for a different value,
+// or, as with Implements, if it reuses a nested type registered with different names.
+func Enum[E integer](names map[string]E) Option {
+	return func(cfg *config) {
+		et := reflect.TypeOf((*E)(nil)).Elem()
+		byName := cfg.conv.enums[et]
+		for name, val := range names {
+			if prev, ok := byName[name]; ok && prev.Interface() != any(val) {
+				cfg.fail(fmt.Errorf("Enum: name %s already registered for %v with value %v", name, et, prev))
+				return
+			}
+		}
+		if cfg.conv.enums == nil {
+			cfg.conv.enums = make(map[reflect.Type]map[string]reflect.Value)
+		}
+		if byName == nil {
+			byName = make(map[string]reflect.Value)
+			cfg.conv.enums[et] = byName
+		}
+		for name, val := range names {
+			byName[name] = reflect.ValueOf(val)
+		}
+	}
+}
+
+// EnumValues is like Enum,
+// but registers each value under the name returned by its String method.
+func EnumValues[E interface {
+	integer
+	String() string
+}](values ...E) Option {
+	names := make(map[string]E, len(values))
+	for _, val := range values {
+		name := val.String()
+		if prev, ok := names[name]; ok && prev != val {
+			return func(cfg *config) {
+				cfg.fail(fmt.Errorf("EnumValues: values %d and %d of %T share name %s", prev, val, val, name))
+			}
+		}
+		names[name] = val
+	}
+	return Enum(names)
+}
+
+// isEnum reports whether typ is an enum type known to conv.
+func (conv *converter) isEnum(typ reflect.Type) bool {
+	_, ok := conv.enums[typ]
+	return ok
+}
+
+// lookupEnum returns the value of the enum type typ named ename,
+// for use as (part of) the value of the field named name.
+func (conv *converter) lookupEnum(name, ename string, typ reflect.Type) reflect.Value {
+	byName := conv.enums[typ]
+	if val, ok := byName[ename]; ok {
+		return val
+	}
+	valid := make([]string, 0, len(byName))
+	for n := range byName {
+		valid = append(valid, n)
+	}
+	sort.Strings(valid)
+	panic(fmt.Sprintf("unknown %v %q for %s (valid values: %s)", typ, ename, name, strings.Join(valid, ", ")))
+}
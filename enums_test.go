@@ -0,0 +1,94 @@
+package tstruct_test
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warn:
+		return "warn"
+	}
+	return "unknown"
+}
+
+type Mode uint8
+
+const (
+	ReadOnly Mode = iota + 1
+	ReadWrite
+)
+
+var loggerEnums = []tstruct.Option{
+	tstruct.EnumValues(Debug, Info, Warn),
+	tstruct.Enum(map[string]Mode{"ro": ReadOnly, "rw": ReadWrite}),
+}
+
+type Logger struct {
+	Level  Level
+	Mode   Mode
+	Levels []Level
+	Caps   map[Level]int
+	Pos    Level `tstruct:"pos=0"`
+}
+
+func TestEnum(t *testing.T) {
+	want := Logger{
+		Level:  Warn,
+		Mode:   ReadWrite,
+		Levels: []Level{Debug, Info},
+		Caps:   map[Level]int{Info: 10, Warn: 1},
+		Pos:    Info,
+	}
+	const tmpl = `
+{{ yield
+	(Logger "info"
+		(Level "warn")
+		(Mode "rw")
+		(Levels "debug" "info")
+		(Caps "info" 10 "warn" 1)
+	)
+}}
+`
+	testOneWith(t, loggerEnums, want, tmpl)
+	// Plain numbers still work.
+	testOneWith(t, loggerEnums, Logger{Level: Warn, Pos: Info}, `{{ yield (Logger 1 (Level 2)) }}`)
+	// Names are scoped to the registration they are passed to.
+	testOneWantErrStrs(t, Logger{}, `{{ yield (Logger (Level "warn")) }}`, []string{"cannot use string as tstruct_test.Level"})
+}
+
+func TestEnumUnknown(t *testing.T) {
+	testOneWithWantErrStrs(t, loggerEnums, Logger{}, `{{ yield (Logger (Level "loud")) }}`, []string{`"loud"`, "valid values: debug, info, warn"})
+}
+
+func TestEnumErrors(t *testing.T) {
+	for _, tt := range []struct {
+		opt  tstruct.Option
+		fail bool
+	}{
+		{tstruct.Enum(map[string]Mode{"ro": ReadWrite}), true},
+		{tstruct.Enum(map[string]Mode{"ro": ReadOnly}), false},
+		{tstruct.EnumValues(Level(7), Level(8)), true},
+	} {
+		m := make(template.FuncMap)
+		err := tstruct.AddFuncMap[Logger](m, append(loggerEnums, tt.opt)...)
+		if got := err != nil; got != tt.fail {
+			t.Errorf("got error %v, want failure %v", err, tt.fail)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Func registers fn under name, for use in struct fields of type F
+// by the registration it is passed to.
+// Templates cannot refer to Go funcs as values,
+// so a template sets a func-typed field by naming a registered func: (Transform "upper").
+// Fields whose type differs from F but has the same underlying type can use fn too.
+// The registration fails if F is not a func type, if fn is nil,
+// or if name is already registered for F,
+// or, as with Implements, if it reuses a nested type registered with different funcs.
+func Func[F any](name string, fn F) Option {
+	return func(cfg *config) {
+		ft := reflect.TypeOf((*F)(nil)).Elem()
+		if ft.Kind() != reflect.Func {
+			cfg.fail(fmt.Errorf("Func: non-func type %v", ft))
+			return
+		}
+		if name == "" {
+			cfg.fail(fmt.Errorf("Func: empty name for %v", ft))
+			return
+		}
+		fv := reflect.ValueOf(fn)
+		if fv.IsNil() {
+			cfg.fail(fmt.Errorf("Func: nil func %s for %v", name, ft))
+			return
+		}
+		if _, ok := cfg.conv.funcs[ft][name]; ok {
+			cfg.fail(fmt.Errorf("Func: %s already registered for %v", name, ft))
+			return
+		}
+		if cfg.conv.funcs == nil {
+			cfg.conv.funcs = make(map[reflect.Type]map[string]reflect.Value)
+		}
+		if cfg.conv.funcs[ft] == nil {
+			cfg.conv.funcs[ft] = make(map[string]reflect.Value)
+		}
+		cfg.conv.funcs[ft][name] = fv
+	}
+}
+
+// lookupFunc returns the func registered under fname for use as a value of type typ,
+// for use as (part of) the value of the field named name.
+// A func registered for typ itself takes precedence.
+// Otherwise, fname must be registered for exactly one func type convertible to typ.
+func (conv *converter) lookupFunc(name, fname string, typ reflect.Type) reflect.Value {
+	if fn, ok := conv.funcs[typ][fname]; ok {
+		return fn
+	}
+	var found reflect.Value
+	var types []string // func types with a func named fname
+	var avail []string
+	for ft, byName := range conv.funcs {
+		if !ft.ConvertibleTo(typ) {
+			continue
+		}
+		if fn, ok := byName[fname]; ok {
+			found = fn
+			types = append(types, ft.String())
+		}
+		for n := range byName {
+			avail = append(avail, n)
+		}
+	}
+	switch {
+	case len(types) == 1:
+		return found.Convert(typ)
+	case len(types) > 1:
+		sort.Strings(types)
+		panic(fmt.Sprintf("func name %q for %s is ambiguous: registered for %s", fname, name, strings.Join(types, ", ")))
+	case len(avail) == 0:
+		panic(fmt.Sprintf("no func named %q for %s: no funcs registered for %v", fname, name, typ))
+	}
+	sort.Strings(avail)
+	panic(fmt.Sprintf("no func named %q for %s (available: %s)", fname, name, strings.Join(avail, ", ")))
+}
@@ -0,0 +1,99 @@
+package tstruct_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Transformer func(string) string
+
+type Pipe struct {
+	Transform  func(string) string
+	Named      Transformer
+	Transforms []func(string) string
+}
+
+var pipeFuncs = []tstruct.Option{
+	tstruct.Func("upper", strings.ToUpper),
+	tstruct.Func("lower", strings.ToLower),
+}
+
+func TestFunc(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Pipe](m, pipeFuncs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m["yield"] = func(p Pipe) string {
+		var out []string
+		for _, fn := range append([]func(string) string{p.Transform, p.Named}, p.Transforms...) {
+			out = append(out, fn("Go"))
+		}
+		return strings.Join(out, " ")
+	}
+	p, err := template.New("test").Funcs(m).Parse(`{{ yield (Pipe (Transform "upper") (Named "lower") (Transforms "lower" "upper")) }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	err = p.Execute(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "GO go go GO"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFuncUnknown(t *testing.T) {
+	type Sorter struct {
+		Less func(a, b int) bool
+	}
+	testOneWithWantErrStrs(t, pipeFuncs, Pipe{}, `{{ yield (Pipe (Transform "title")) }}`, []string{`no func named "title"`, "available: lower, upper"})
+	testOneWantErrStrs(t, Sorter{}, `{{ yield (Sorter (Less "asc")) }}`, []string{"no funcs registered"})
+}
+
+func TestFuncAmbiguous(t *testing.T) {
+	type Mapper func(string) string
+	type Piped struct {
+		Named Transformer
+		Plain func(string) string
+	}
+	opts := []tstruct.Option{
+		tstruct.Func[Transformer]("x", strings.ToUpper),
+		tstruct.Func[Mapper]("x", strings.ToLower),
+		tstruct.Func[Mapper]("y", strings.ToLower),
+	}
+	// An exact type match wins; otherwise the name must be unique among convertible types.
+	testOneWithWantErrStrs(t, opts, Piped{}, `{{ yield (Piped (Plain "x")) }}`, []string{`func name "x" for Plain is ambiguous`, "tstruct_test.Mapper, tstruct_test.Transformer"})
+	m := make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Piped](m, opts...); err != nil {
+		t.Fatal(err)
+	}
+	m["yield"] = func(p Piped) string { return p.Named("Go") + " " + p.Plain("Go") }
+	p := template.Must(template.New("test").Funcs(m).Parse(`{{ yield (Piped (Named "x") (Plain "y")) }}`))
+	var buf strings.Builder
+	if err := p.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "GO go"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFuncErrors(t *testing.T) {
+	for _, opt := range []tstruct.Option{
+		tstruct.Func("upper", strings.ToUpper),
+		tstruct.Func("x", 1),
+		tstruct.Func[func()]("x", nil),
+		tstruct.Func("", strings.ToUpper),
+	} {
+		m := make(template.FuncMap)
+		if err := tstruct.AddFuncMap[Pipe](m, append(pipeFuncs, opt)...); err == nil {
+			t.Errorf("expected error, got %v", m)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// isGenericName reports whether name is the name of a generic func.
+func isGenericName(name string) bool {
+	return name == "New" || name == "Set"
+}
+
+// enableGeneric adds the generic funcs to st, if they are not already there.
+func (st *registryState) enableGeneric() error {
+	if st.generic {
+		return nil
+	}
+	for _, name := range []string{"New", "Set"} {
+		err := st.checkUnused(name)
+		if err != nil {
+			return fmt.Errorf("cannot add generic funcs: %v", err)
+		}
+	}
+	st.generic = true
+	return nil
+}
+
+// newFunc returns the generic func New for st.
+// (New "T" args...) is equivalent to (T args...),
+// where T is a constructor name or the name of a struct type.
+func (st *registryState) newFunc() genericNew {
+	return func(args ...reflect.Value) (reflect.Value, error) {
+		if q, ok := isGenericQuery(args); ok {
+			q.st = st
+			return reflect.Value{}, nil
+		}
+		name, err := genericName("New", args)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		info, err := st.lookupCtor(name)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		out := reflect.ValueOf(info.ctor).Call(args[1:])
+		return out[0], nil
+	}
+}
+
+// setFunc returns the generic func Set for st.
+// (Set "F" args...) is equivalent to (F args...), where F is a setter name.
+func (st *registryState) setFunc() genericSet {
+	return func(args ...reflect.Value) (applyFn, error) {
+		if q, ok := isGenericQuery(args); ok {
+			q.st = st
+			return nil, nil
+		}
+		name, err := genericName("Set", args)
+		if err != nil {
+			return nil, err
+		}
+		t, ok := st.setters[name]
+		if !ok {
+			return nil, fmt.Errorf("Set: no field setter named %s", name)
+		}
+		return t.savedApplyFn(name, st.template)(args[1:]...), nil
+	}
+}
+
+// genericName returns the name passed as the first of args to the generic func fn.
+func genericName(fn string, args []reflect.Value) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("%s: missing name", fn)
+	}
+	arg := devirt(args[0])
+	if arg.Kind() != reflect.String {
+		return "", fmt.Errorf("%s: name must be a string, got %v", fn, arg.Type())
+	}
+	return arg.String(), nil
+}
+
+// lookupCtor returns the constructor in st for name,
+// which is a constructor name or a struct type name, optionally qualified by package name.
+func (st *registryState) lookupCtor(name string) (*structInfo, error) {
+	if info, ok := st.ctors[name]; ok {
+		return info, nil
+	}
+	var found *structInfo
+	var names []string // constructor names of matching types
+	for cname, info := range st.ctors {
+		if info.typ.Name() != name && info.typ.String() != name {
+			continue
+		}
+		if found == nil || found.typ != info.typ {
+			names = append(names, cname)
+		}
+		found = info
+	}
+	switch {
+	case found == nil:
+		return nil, fmt.Errorf("New: no struct type named %s", name)
+	case len(names) > 1:
+		sort.Strings(names)
+		return nil, fmt.Errorf("New: %s is ambiguous, could be any of %s", name, strings.Join(names, ", "))
+	}
+	return found, nil
+}
+
+// genericQuery is a special sentinel type that the generic funcs recognize.
+// When passed a *genericQuery as their only arg,
+// the generic funcs record their registry state in it,
+// and return zero values, without doing any further work.
+type genericQuery struct {
+	st *registryState
+}
+
+// isGenericQuery reports whether args is a request for a generic func to report its state.
+// If so, it returns the query to fill in.
+func isGenericQuery(args []reflect.Value) (*genericQuery, bool) {
+	if len(args) != 1 {
+		return nil, false
+	}
+	q, ok := devirt(args[0]).Interface().(*genericQuery)
+	return q, ok
+}
+
+// genericNew and genericSet are the types of the generic funcs New and Set.
+// Only tstruct creates values of these types,
+// so the generic funcs can be recognized without calling them.
+type (
+	genericNew func(args ...reflect.Value) (reflect.Value, error)
+	genericSet func(args ...reflect.Value) (applyFn, error)
+)
+
+// queryGeneric returns the registry state of x,
+// or nil if x is not a generic func generated by tstruct.
+// It only calls x if x is such a func.
+func queryGeneric(x any) *registryState {
+	q := new(genericQuery)
+	arg := reflect.ValueOf(q)
+	switch fn := x.(type) {
+	case genericNew:
+		fn(arg)
+	case genericSet:
+		fn(arg)
+	default:
+		return nil
+	}
+	return q.st
+}
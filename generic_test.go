@@ -0,0 +1,161 @@
+package tstruct_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+func TestGenericFuncs(t *testing.T) {
+	m := make(template.FuncMap)
+	var rep tstruct.Report
+	err := tstruct.AddFuncMap[Deploy](m, tstruct.GenericFuncs(), tstruct.ReportTo(&rep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rep.Constructors[1].String(), "tstruct_test.Backend: only through New (Backend is taken)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Backend is a field setter, so its type is only available through New.
+	// The Route type was registered before the Route field, so the field is only available through Set.
+	want := Deploy{
+		Backend: "b",
+		Primary: Backend{Addr: "p"},
+		Route:   Route{Path: "/", To: Backend{Addr: "r", Weight: 3}, Weight: 2},
+	}
+	testGeneric(t, m, want, `{{ yield (New "Deploy" (Backend "b") (Primary (New "Backend" (Addr "p"))) (Set "Route" (New "tstruct_test.Route" "/" (Set "Weight" 2) (To (New "Backend" (Set "Addr" "r") (Weight 3)))))) }}`)
+	testGeneric(t, m, Route{Path: "/", Weight: 1}, `{{ yield (Route "/" (Weight 1)) }}`)
+
+	// Later registrations keep the generic funcs and the hidden constructors.
+	type Other struct{ Addr string }
+	if err := tstruct.AddFuncMap[Other](m); err != nil {
+		t.Fatal(err)
+	}
+	testGeneric(t, m, Backend{Addr: "x"}, `{{ yield (New "Backend" (Addr "x")) }}`)
+}
+
+func TestGenericFuncsHiddenSetter(t *testing.T) {
+	m := template.FuncMap{"Port": strings.ToUpper}
+	err := tstruct.AddFuncMap[Listener](m, tstruct.GenericFuncs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGeneric(t, m, Listener{Addr: "a", Port: 80}, `{{ yield (Listener (Set "Addr" "a") (Set "Port" 80)) }}`)
+	var setters []string
+	for _, s := range tstruct.FromFuncMap(m).Setters() {
+		if s.Hidden {
+			setters = append(setters, s.Name)
+		}
+	}
+	if !reflect.DeepEqual(setters, []string{"Port"}) {
+		t.Errorf("got hidden setters %v, want [Port]", setters)
+	}
+}
+
+func TestGenericFuncsFromSeveralRegistries(t *testing.T) {
+	// In r1, the Backend constructor and the Route setter are hidden; in r2, the Port setter is.
+	r1 := tstruct.NewRegistry()
+	if err := tstruct.Register[Deploy](r1, tstruct.GenericFuncs()); err != nil {
+		t.Fatal(err)
+	}
+	r2 := tstruct.NewRegistry()
+	if err := r2.Merge(template.FuncMap{"Port": strings.ToUpper}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.Register[Listener](r2, tstruct.GenericFuncs()); err != nil {
+		t.Fatal(err)
+	}
+	m := r1.FuncMap()
+	m["Set"] = r2.FuncMap()["Set"]
+	m["count"] = func(args ...reflect.Value) (int, error) {
+		t.Error("count called")
+		return len(args), nil
+	}
+	r := tstruct.FromFuncMap(m)
+	var hidden []string
+	for _, s := range r.Structs() {
+		if s.Hidden {
+			hidden = append(hidden, s.Name)
+		}
+	}
+	for _, s := range r.Setters() {
+		if s.Hidden {
+			hidden = append(hidden, s.Name)
+		}
+	}
+	if want := []string{"Backend", "Port", "Route"}; !reflect.DeepEqual(hidden, want) {
+		t.Errorf("got hidden entries %v, want %v", hidden, want)
+	}
+}
+
+func TestGenericFuncsSameTypeName(t *testing.T) {
+	type Decoders struct {
+		JSON json.Decoder
+	}
+	m := make(template.FuncMap)
+	var rep tstruct.Report
+	err := tstruct.AddFuncMap[Decoders](m, tstruct.GenericFuncs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// xml.Decoder's constructor name is taken by json.Decoder's.
+	err = tstruct.AddFuncMap[xml.Decoder](m, tstruct.ReportTo(&rep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rep.Constructors[0].String(), "xml.Decoder: only through New (Decoder is taken)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	testGeneric(t, m, xml.Decoder{Strict: true, DefaultSpace: "x"}, `{{ yield (New "xml.Decoder" (Set "Strict" true) (DefaultSpace "x")) }}`)
+	testGeneric(t, m, json.Decoder{}, `{{ yield (Decoder) }}`)
+	// Later registrations keep it.
+	if err := tstruct.AddFuncMap[Listener](m); err != nil {
+		t.Fatal(err)
+	}
+	testGeneric(t, m, xml.Decoder{Strict: true}, `{{ yield (New "xml.Decoder" (Strict true)) }}`)
+}
+
+func TestGenericFuncsErrors(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Listener](m, tstruct.GenericFuncs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tmpl, want := range map[string]string{
+		`{{ New "Nope" }}`:              "no struct type named Nope",
+		`{{ New }}`:                     "missing name",
+		`{{ New 1 }}`:                   "name must be a string",
+		`{{ Listener (Set "Nope" 1) }}`: "no field setter named Nope",
+		`{{ New "Listener" }}`:          "Listener.Addr required but not provided",
+	} {
+		p := template.Must(template.New("test").Funcs(m).Parse(tmpl))
+		err := p.Execute(&strings.Builder{}, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", tmpl, want, err)
+		}
+	}
+
+	m = template.FuncMap{"New": strings.ToUpper}
+	if err := tstruct.AddFuncMap[Listener](m, tstruct.GenericFuncs()); err == nil {
+		t.Error("expected error when New is taken")
+	}
+}
+
+func testGeneric(t *testing.T, m template.FuncMap, want any, tmpl string) {
+	t.Helper()
+	m["yield"] = func(x any) error {
+		if !reflect.DeepEqual(x, want) {
+			t.Fatalf("got %#v, want %#v", x, want)
+		}
+		return nil
+	}
+	p := template.Must(template.New("test").Funcs(m).Parse(tmpl))
+	if err := p.Execute(&strings.Builder{}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Implements registers the types of impls as implementations of the interface type I,
+// for use by the registration it is passed to.
+// When the registered struct type, or an automatically registered nested type,
+// has a field of type I (or a slice or map of I),
+// constructors for each struct type among impls are added too,
+// so that templates can construct values to store in the field.
+// If only *X implements I, a constructed X is stored in the field as a *X.
+// Implements may be passed more than once, for the same or different interface types.
+// A nested type that an earlier registration already added is reused, not registered again,
+// so the registration fails if the two registrations' options differ for the nested type's fields.
+func Implements[I any](impls ...any) Option {
+	return func(cfg *config) {
+		it := reflect.TypeOf((*I)(nil)).Elem()
+		if it.Kind() != reflect.Interface {
+			cfg.fail(fmt.Errorf("Implements: non-interface type %v", it))
+			return
+		}
+		for _, impl := range impls {
+			if impl == nil {
+				cfg.fail(fmt.Errorf("Implements: nil implementation of %v", it))
+				return
+			}
+			typ := reflect.TypeOf(impl)
+			if !typ.Implements(it) && !reflect.PtrTo(typ).Implements(it) {
+				cfg.fail(fmt.Errorf("Implements: %v does not implement %v", typ, it))
+				return
+			}
+			cfg.conv.addImpl(it, typ)
+		}
+	}
+}
+
+// addImpl records typ as an implementation of the interface type it.
+func (conv *converter) addImpl(it, typ reflect.Type) {
+	if conv.impls == nil {
+		conv.impls = make(map[reflect.Type][]reflect.Type)
+	}
+	if !containsType(conv.impls[it], typ) {
+		conv.impls[it] = append(conv.impls[it], typ)
+	}
+}
+
+// implementations returns the implementations of the interface type it known to conv.
+func (conv *converter) implementations(it reflect.Type) []reflect.Type {
+	return conv.impls[it]
+}
+
+func containsType(typs []reflect.Type, typ reflect.Type) bool {
+	for _, t := range typs {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// convertToInterface converts src to the interface type it,
+// for use as (part of) the value of the field named name.
+func (conv *converter) convertToInterface(name string, src reflect.Value, it reflect.Type) reflect.Value {
+	if src.Type().AssignableTo(it) {
+		return src.Convert(it)
+	}
+	if reflect.PtrTo(src.Type()).Implements(it) {
+		// Only *X implements it. Store a pointer to a copy of src.
+		p := reflect.New(src.Type())
+		p.Elem().Set(src)
+		return p.Convert(it)
+	}
+	msg := fmt.Sprintf("cannot use %v as %v in %s: %v does not implement %v", src.Type(), it, name, src.Type(), it)
+	if typs := conv.implementations(it); len(typs) > 0 {
+		names := make([]string, len(typs))
+		for i, typ := range typs {
+			names[i] = typ.String()
+		}
+		sort.Strings(names)
+		msg += fmt.Sprintf(" (registered implementations: %s)", strings.Join(names, ", "))
+	}
+	panic(msg)
+}
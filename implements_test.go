@@ -0,0 +1,114 @@
+package tstruct_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Step interface {
+	Run() string
+}
+
+type BuildStep struct {
+	Target string
+}
+
+func (s BuildStep) Run() string { return "build " + s.Target }
+
+type TestStep struct {
+	Pkg     string
+	Verbose bool
+}
+
+func (s *TestStep) Run() string { return "test " + s.Pkg }
+
+type Pipeline struct {
+	First Step
+	Steps []Step
+	Named map[string]Step
+}
+
+var stepImpls = []tstruct.Option{tstruct.Implements[Step](BuildStep{}, &TestStep{})}
+
+func TestImplements(t *testing.T) {
+	want := Pipeline{
+		First: BuildStep{Target: "all"},
+		Steps: []Step{BuildStep{Target: "x"}, &TestStep{Pkg: "y", Verbose: true}},
+		Named: map[string]Step{"t": &TestStep{Pkg: "z"}},
+	}
+	const tmpl = `
+{{ yield
+	(Pipeline
+		(First (BuildStep (Target "all")))
+		(Steps (BuildStep (Target "x")) (TestStep (Pkg "y") (Verbose)))
+		(Named "t" (TestStep (Pkg "z")))
+	)
+}}
+`
+	testOneWith(t, stepImpls, want, tmpl)
+	// Implementations are scoped to the registration they are passed to.
+	m := make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Pipeline](m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["BuildStep"]; ok {
+		t.Error("BuildStep registered without the Implements option")
+	}
+}
+
+func TestImplementsWrongType(t *testing.T) {
+	testOneWithWantErrStrs(t, stepImpls, Pipeline{}, `{{ yield (Pipeline (First "x")) }}`,
+		[]string{"string does not implement tstruct_test.Step", "registered implementations: *tstruct_test.TestStep, tstruct_test.BuildStep"})
+}
+
+func TestImplementsSharedNested(t *testing.T) {
+	type Sub struct {
+		S  Step
+		Lv Level
+	}
+	type HoldA struct{ A Sub }
+	type HoldB struct{ B Sub }
+	opts := append([]tstruct.Option{tstruct.Implements[Step](BuildStep{})}, loggerEnums...)
+	for _, tt := range []struct {
+		aOpts, bOpts []tstruct.Option
+		ok           bool
+	}{
+		{nil, opts, false},
+		{opts, nil, false},
+		{opts, []tstruct.Option{tstruct.Implements[Step](BuildStep{}, &TestStep{})}, false},
+		{opts, opts, true},
+		{nil, []tstruct.Option{tstruct.Func("upper", strings.ToUpper)}, true}, // Sub has no func fields
+	} {
+		m := make(template.FuncMap)
+		if err := tstruct.AddFuncMap[HoldA](m, tt.aOpts...); err != nil {
+			t.Fatal(err)
+		}
+		err := tstruct.AddFuncMap[HoldB](m, tt.bOpts...)
+		if !tt.ok {
+			if err == nil || !strings.Contains(err.Error(), "already registered with different Implements, Func, or Enum options") {
+				t.Errorf("%d options then %d: got %v, want options error", len(tt.aOpts), len(tt.bOpts), err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	testOneWith(t, opts, HoldB{B: Sub{S: BuildStep{Target: "x"}, Lv: Warn}}, `{{ yield (HoldB (B (Sub (S (BuildStep (Target "x"))) (Lv "warn")))) }}`)
+}
+
+func TestImplementsErrors(t *testing.T) {
+	for _, opt := range []tstruct.Option{
+		tstruct.Implements[BuildStep](BuildStep{}),
+		tstruct.Implements[Step](Pipeline{}),
+		tstruct.Implements[Step](nil),
+	} {
+		m := make(template.FuncMap)
+		if err := tstruct.AddFuncMap[Pipeline](m, opt); err == nil {
+			t.Errorf("expected error, got %v", m)
+		}
+	}
+}
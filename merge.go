@@ -0,0 +1,129 @@
+package tstruct
+
+import (
+	"reflect"
+	"sort"
+)
+
+// MergeFuncMaps returns a new FuncMap containing the entries of all of maps,
+// which may have been populated by separate calls to AddFuncMap.
+// Field setters that share a name dispatch to the struct types from all maps.
+// A constructor registered in several maps for the same struct type is kept once.
+// Any other use of a name in more than one map is a conflict,
+// unless the entries are the same func.
+// If there are any, MergeFuncMaps returns a *ConflictError describing all of them.
+func MergeFuncMaps(maps ...map[string]any) (map[string]any, error) {
+	st := newRegistryState()
+	var conflicts []Conflict
+	for _, m := range maps {
+		// Keep going after a conflict, to report conflicts in later maps too.
+		conflicts = append(conflicts, sortConflicts(st.merge(loadFuncMap(m)))...)
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{Conflicts: conflicts}
+	}
+	return st.funcMap(), nil
+}
+
+// Merge adds the entries in fnmap to r, following the rules of MergeFuncMaps.
+// If Merge returns a non-nil error, r is unmodified.
+func (r *Registry) Merge(fnmap map[string]any) error {
+	src := loadFuncMap(fnmap)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.state().clone()
+	conflicts := st.merge(src)
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: sortConflicts(conflicts)}
+	}
+	r.st = st
+	return nil
+}
+
+// sortConflicts sorts conflicts by name, and returns them.
+func sortConflicts(conflicts []Conflict) []Conflict {
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Name < conflicts[j].Name })
+	return conflicts
+}
+
+// merge adds the entries in src to st.
+// It returns all conflicts; st must be discarded if there are any,
+// but it may be used to merge more maps, to find their conflicts too.
+// Conflicting entries from src are not added.
+func (st *registryState) merge(src *registryState) []Conflict {
+	var conflicts []Conflict
+	conflict := func(name string) {
+		conflicts = append(conflicts, Conflict{
+			Name:  name,
+			Uses:  []string{st.describe(name), src.describe(name)},
+			Types: append(st.typesOf(name), src.typesOf(name)...),
+		})
+	}
+	if src.generic && !st.generic {
+		for _, name := range []string{"New", "Set"} {
+			if !st.isUnused(name) {
+				conflict(name)
+			}
+		}
+		st.generic = true
+	}
+	for name, info := range src.ctors {
+		prev, ok := st.ctors[name]
+		switch {
+		case ok && prev.typ == info.typ:
+			st.ctors[name] = mergeStructInfo(prev, info)
+		case !ok && (info.hidden || st.isUnused(name)):
+			st.ctors[name] = info
+		default:
+			conflict(name)
+		}
+	}
+	for name, t := range src.setters {
+		prev, ok := st.setters[name]
+		switch {
+		case ok:
+			for _, e := range t.entries {
+				if prev.lookup(e.typ) == nil {
+					prev = prev.with(e)
+				}
+			}
+			st.setters[name] = prev
+		case t.hidden || st.isUnused(name):
+			st.setters[name] = t
+		default:
+			conflict(name)
+		}
+	}
+	for name, x := range src.others {
+		prev, ok := st.others[name]
+		switch {
+		case ok && sameFunc(prev, x):
+			// Nothing to do.
+		case st.isUnused(name):
+			st.others[name] = x
+		default:
+			conflict(name)
+		}
+	}
+	return conflicts
+}
+
+// mergeStructInfo returns the structInfo to use for a struct type registered as both a and b.
+// It prefers an explicit registration to an automatic one.
+func mergeStructInfo(a, b *structInfo) *structInfo {
+	if a.nested && !b.nested {
+		return b
+	}
+	return a
+}
+
+// isUnused reports whether name is unused in st.
+func (st *registryState) isUnused(name string) bool {
+	return st.checkUnused(name) == nil
+}
+
+// sameFunc reports whether x and y are the same func.
+func sameFunc(x, y any) bool {
+	xv, yv := reflect.ValueOf(x), reflect.ValueOf(y)
+	return xv.Kind() == reflect.Func && xv.Type() == yv.Type() && xv.Pointer() == yv.Pointer()
+}
@@ -0,0 +1,107 @@
+package tstruct_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+func TestMergeFuncMaps(t *testing.T) {
+	type A struct{ Name string }
+	type B struct{ Name int }
+	show := func(x any) string { return fmt.Sprintf("%+v", x) }
+	ma := template.FuncMap{"show": show}
+	if err := tstruct.AddFuncMap[A](ma); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Route](ma); err != nil {
+		t.Fatal(err)
+	}
+	mb := template.FuncMap{"show": show}
+	if err := tstruct.AddFuncMap[B](mb); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Backend](mb); err != nil {
+		t.Fatal(err)
+	}
+	m, err := tstruct.MergeFuncMaps(ma, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Plain copying would leave Name dispatching only to B.
+	const tmpl = `{{ show (A (Name "x")) }} {{ show (B (Name 1)) }} {{ show (Backend (Addr "b")) }} {{ show (Route "/" (Weight 2)) }}`
+	var buf strings.Builder
+	if err := template.Must(template.New("test").Funcs(m).Parse(tmpl)).Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "{Name:x} {Name:1} {Addr:b Weight:0} {Path:/ To:{Addr: Weight:0} Weight:2 Prio:0}"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	// Backend was registered explicitly in mb, so it is not nested in the merged map.
+	for _, s := range tstruct.FromFuncMap(m).Structs() {
+		if s.Name == "Backend" && s.Nested {
+			t.Error("Backend is nested after merge")
+		}
+	}
+}
+
+func TestMergeFuncMapsConflicts(t *testing.T) {
+	type Name struct{}
+	type A struct{ Name string }
+	type Addr struct{}
+	ma := template.FuncMap{"show": func(x any) string { return "" }}
+	if err := tstruct.AddFuncMap[A](ma); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Listener](ma); err != nil {
+		t.Fatal(err)
+	}
+	mb := template.FuncMap{"show": func(x any) string { return "!" }, "Port": strings.ToUpper}
+	if err := tstruct.AddFuncMap[Name](mb); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Addr](mb); err != nil {
+		t.Fatal(err)
+	}
+	_, err := tstruct.MergeFuncMaps(ma, mb)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		"Addr is a field setter for tstruct_test.Listener and the constructor for tstruct_test.Addr",
+		"Name is a field setter for tstruct_test.A and the constructor for tstruct_test.Name",
+		"Port is a field setter for tstruct_test.Listener and a func(string) string",
+		"show is a func(interface {}) string and a func(interface {}) string",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %q", want, err)
+		}
+	}
+}
+
+func TestMergeFuncMapsConflictsInSeveralMaps(t *testing.T) {
+	type MA struct{ F int }
+	ma := template.FuncMap{"f": strings.ToUpper, "g": strings.ToLower}
+	if err := tstruct.AddFuncMap[MA](ma); err != nil {
+		t.Fatal(err)
+	}
+	mb := template.FuncMap{"f": strings.TrimSpace, "MA": strings.ToUpper}
+	mc := template.FuncMap{"g": strings.TrimSpace}
+	_, err := tstruct.MergeFuncMaps(ma, mb, mc)
+	var cerr *tstruct.ConflictError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected *ConflictError, got %v", err)
+	}
+	var got []string
+	for _, c := range cerr.Conflicts {
+		got = append(got, c.Name)
+	}
+	if want := []string{"MA", "f", "g"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got conflicts over %v, want %v", got, want)
+	}
+}
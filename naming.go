@@ -0,0 +1,198 @@
+package tstruct
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// genericTypeName converts the name of an instantiated generic type,
+// such as "Page[example.com/x.Item]", into a template identifier, such as "PageOfItem".
+// Multiple type arguments are joined with And: Pair[int,string] becomes PairOfIntAndString.
+// Composite type arguments are spelled out: []*Item becomes SliceOfPtrToItem,
+// and map[string]int becomes MapOfStringToInt.
+// genericTypeName reports false if name is not generic
+// or has type arguments that it cannot spell, such as func types.
+func genericTypeName(name string) (string, bool) {
+	if !strings.Contains(name, "[") {
+		return "", false
+	}
+	p := &typeNameParser{s: name, ok: true}
+	out := p.typ()
+	return out, p.ok && p.s == ""
+}
+
+// typeNameParser parses type names as printed by reflect.
+type typeNameParser struct {
+	s  string // remaining input
+	ok bool
+}
+
+func (p *typeNameParser) consume(prefix string) bool {
+	if !strings.HasPrefix(p.s, prefix) {
+		return false
+	}
+	p.s = p.s[len(prefix):]
+	return true
+}
+
+func (p *typeNameParser) expect(prefix string) {
+	if !p.consume(prefix) {
+		p.ok = false
+	}
+}
+
+// typ parses a type and returns its spelled-out name.
+func (p *typeNameParser) typ() string {
+	if !p.ok {
+		return ""
+	}
+	switch {
+	case p.consume("[]"):
+		return "SliceOf" + p.typ()
+	case p.consume("*"):
+		return "PtrTo" + p.typ()
+	case p.consume("map["):
+		key := p.typ()
+		p.expect("]")
+		return "MapOf" + key + "To" + p.typ()
+	case p.consume("["):
+		// Array type. The length is not part of the name.
+		i := strings.IndexByte(p.s, ']')
+		if i < 0 {
+			p.ok = false
+			return ""
+		}
+		p.s = p.s[i+1:]
+		return "ArrayOf" + p.typ()
+	}
+	// A possibly package-qualified named type, possibly with type arguments.
+	i := strings.IndexAny(p.s, "[],")
+	if i < 0 {
+		i = len(p.s)
+	}
+	qual := p.s[:i]
+	p.s = p.s[i:]
+	if strings.ContainsAny(qual, " (){}") {
+		// func, chan, struct, or interface type
+		p.ok = false
+		return ""
+	}
+	qual = qual[strings.LastIndexByte(qual, '/')+1:]
+	name := exported(qual[strings.LastIndexByte(qual, '.')+1:])
+	if name == "" {
+		p.ok = false
+		return ""
+	}
+	if !p.consume("[") {
+		return name
+	}
+	var args []string
+	for p.ok {
+		args = append(args, p.typ())
+		if !p.consume(",") {
+			break
+		}
+	}
+	p.expect("]")
+	return name + "Of" + strings.Join(args, "And")
+}
+
+// exported returns s with its first letter upper-cased.
+func exported(s string) string {
+	if s == "" {
+		return ""
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// isTemplateIdent reports whether s is usable as a template func name.
+func isTemplateIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_':
+		case i == 0 && !unicode.IsLetter(r):
+			return false
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			return false
+		}
+	}
+	return true
+}
+
+// A Namer derives a template-visible name from a Go name.
+// For struct fields, field is the field being named; for struct types, it is nil.
+// For instantiated generic types, goName is the spelled-out name, such as PageOfItem.
+type Namer func(goName string, field *reflect.StructField) string
+
+// SnakeCase is a Namer that converts names to snake_case: ListenPort becomes listen_port.
+func SnakeCase(goName string, field *reflect.StructField) string {
+	words := splitWords(goName)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return strings.Join(words, "_")
+}
+
+// LowerCamel is a Namer that converts names to lowerCamelCase: ListenPort becomes listenPort.
+func LowerCamel(goName string, field *reflect.StructField) string {
+	words := splitWords(goName)
+	if len(words) > 0 {
+		words[0] = strings.ToLower(words[0])
+	}
+	return strings.Join(words, "")
+}
+
+// JSONNames is a Namer that names fields after their json struct tags, as in `json:"listen_port"`.
+// Fields without a json tag name, and struct types, keep their Go names.
+func JSONNames(goName string, field *reflect.StructField) string {
+	if field == nil {
+		return goName
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return goName
+	}
+	return name
+}
+
+// splitWords splits a Go name into words at case changes and underscores.
+// Initialisms stay together: HTTPServer is HTTP Server.
+func splitWords(s string) []string {
+	var words []string
+	runes := []rune(s)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) && !wordBoundary(runes, i) {
+			continue
+		}
+		if w := strings.Trim(string(runes[start:i]), "_"); w != "" {
+			words = append(words, w)
+		}
+		start = i
+	}
+	return words
+}
+
+// wordBoundary reports whether a new word starts at runes[i].
+func wordBoundary(runes []rune, i int) bool {
+	prev, cur := runes[i-1], runes[i]
+	switch {
+	case cur == '_' || prev == '_':
+		return true
+	case !unicode.IsUpper(cur):
+		return false
+	case unicode.IsLower(prev) || unicode.IsDigit(prev):
+		// fooBar, foo2Bar
+		return true
+	case i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+		// The last capital of an initialism followed by a word: HTTPServer
+		return unicode.IsUpper(prev)
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package tstruct_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Item struct {
+	ID int
+}
+
+type Page[T any] struct {
+	Items []T
+	Next  *int
+}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+type Catalog struct {
+	Featured Page[Item]
+	Counts   Pair[string, []*Item]
+	Index    Pair[int, map[string]Page[Item]]
+}
+
+func TestGenericNames(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Catalog](m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"Catalog",
+		"PageOfItem",
+		"PairOfStringAndSliceOfPtrToItem",
+		"PairOfIntAndMapOfStringToPageOfItem",
+	} {
+		if _, ok := m[name]; !ok {
+			t.Errorf("missing FuncMap entry %s", name)
+		}
+	}
+	want := Catalog{Featured: Page[Item]{Items: []Item{{ID: 1}, {ID: 2}}}}
+	testOne(t, want, `{{ yield (Catalog (Featured (PageOfItem (Items (Item (ID 1)) (Item (ID 2)))))) }}`)
+}
+
+func TestGenericTopLevel(t *testing.T) {
+	testOne(t, Page[Item]{Items: []Item{{ID: 1}}}, `{{ yield (PageOfItem (Items (Item (ID 1)))) }}`)
+}
+
+func TestNameOption(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Page[Item]](m, tstruct.Name("ItemPage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["ItemPage"]; !ok {
+		t.Errorf("missing FuncMap entry ItemPage")
+	}
+	if _, ok := m["PageOfItem"]; ok {
+		t.Errorf("unexpected FuncMap entry PageOfItem")
+	}
+}
+
+func TestUnnameableGeneric(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Page[func()]](m)
+	if err == nil || !strings.Contains(err.Error(), "Name option") {
+		t.Fatalf("expected error suggesting the Name option, got %v", err)
+	}
+	err = tstruct.AddFuncMap[Page[func()]](m, tstruct.Name("FuncPage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tstruct.AddFuncMap[Item](m, tstruct.Name("not valid"))
+	if err == nil {
+		t.Fatal("expected error for invalid name")
+	}
+}
+
+func TestUnnameableNestedGeneric(t *testing.T) {
+	type Holder struct{ P Page[func()] }
+	type NoregHolder struct {
+		P Page[func()] `tstruct:"noreg"`
+	}
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Holder](m)
+	if err == nil || !strings.Contains(err.Error(), "noreg") || strings.Contains(err.Error(), "use the Name option") {
+		t.Fatalf("expected error suggesting noreg, got %v", err)
+	}
+	if err := tstruct.AddFuncMap[NoregHolder](m); err != nil {
+		t.Fatal(err)
+	}
+	// A nested type registered explicitly first is reused under its chosen name.
+	if err := tstruct.AddFuncMap[Page[func()]](m, tstruct.Name("FuncPage")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Holder](m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSameNameDifferentTypes(t *testing.T) {
+	// Two distinct types named User, registered as nested types.
+	type User struct{ A int }
+	type Wrap1 struct{ X User }
+	makeWrap2 := func(m map[string]any) error {
+		type User struct{ B string }
+		type Wrap2 struct{ Y User }
+		return tstruct.AddFuncMap[Wrap2](m)
+	}
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Wrap1](m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = makeWrap2(m)
+	if err == nil || !strings.Contains(err.Error(), "disambiguate") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+}
+
+func TestQualifyNames(t *testing.T) {
+	type Codecs struct {
+		JSON json.Decoder
+		XML  xml.Decoder
+	}
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Codecs](m)
+	if err == nil {
+		t.Fatal("expected conflict error")
+	}
+	err = tstruct.AddFuncMap[Codecs](m, tstruct.QualifyNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"tstruct_test_Codecs", "json_Decoder", "xml_Decoder"} {
+		if _, ok := m[name]; !ok {
+			t.Errorf("missing FuncMap entry %s", name)
+		}
+	}
+	// Field setters still dispatch to the right type.
+	var got Codecs
+	m["yield"] = func(c Codecs) string {
+		got = c
+		return ""
+	}
+	p, err := template.New("test").Funcs(m).Parse(`{{ yield (tstruct_test_Codecs (XML (xml_Decoder (Strict true) (DefaultSpace "x")))) }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Execute(io.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.XML.Strict || got.XML.DefaultSpace != "x" {
+		t.Errorf("got %+v", got.XML)
+	}
+}
+
+func TestNamers(t *testing.T) {
+	for _, tt := range []struct {
+		in, snake, camel string
+	}{
+		{"ListenPort", "listen_port", "listenPort"},
+		{"URL", "url", "url"},
+		{"HTTPServer", "http_server", "httpServer"},
+		{"ServerID", "server_id", "serverID"},
+		{"PageOfItem", "page_of_item", "pageOfItem"},
+		{"Already_Snake", "already_snake", "alreadySnake"},
+		{"X", "x", "x"},
+	} {
+		if got := tstruct.SnakeCase(tt.in, nil); got != tt.snake {
+			t.Errorf("SnakeCase(%q) = %q, want %q", tt.in, got, tt.snake)
+		}
+		if got := tstruct.LowerCamel(tt.in, nil); got != tt.camel {
+			t.Errorf("LowerCamel(%q) = %q, want %q", tt.in, got, tt.camel)
+		}
+	}
+}
+
+type HTTPServer struct {
+	ListenPort int    `json:"port"`
+	Host       string `json:"host,omitempty"`
+	Timeout    int    `json:",omitempty"`
+	TLS        TLSConfig
+	Admin      bool `json:"-" tstruct:"name=AdminMode"`
+}
+
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+}
+
+func TestNaming(t *testing.T) {
+	for _, tt := range []struct {
+		namer tstruct.Namer
+		names []string
+	}{
+		{tstruct.SnakeCase, []string{"http_server", "listen_port", "host", "timeout", "tls", "tls_config", "cert_file", "AdminMode"}},
+		{tstruct.LowerCamel, []string{"httpServer", "listenPort", "host", "timeout", "tls", "tlsConfig", "certFile", "AdminMode"}},
+		{tstruct.JSONNames, []string{"HTTPServer", "port", "host", "Timeout", "TLS", "TLSConfig", "cert_file", "AdminMode"}},
+	} {
+		m := make(template.FuncMap)
+		err := tstruct.AddFuncMap[HTTPServer](m, tstruct.Naming(tt.namer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for name := range m {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		sort.Strings(tt.names)
+		if !reflect.DeepEqual(got, tt.names) {
+			t.Errorf("got %v, want %v", got, tt.names)
+		}
+	}
+}
+
+func TestNamingErrors(t *testing.T) {
+	type Required struct {
+		ListenPort int `tstruct:"+"`
+	}
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Required](m, tstruct.Naming(tstruct.SnakeCase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m["yield"] = func(any) string { return "" }
+	p, err := template.New("test").Funcs(m).Parse(`{{ yield (required) }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Execute(io.Discard, nil)
+	if err == nil || !strings.Contains(err.Error(), "required.listen_port required") {
+		t.Errorf("expected error mentioning required.listen_port, got %v", err)
+	}
+
+	type Dashed struct {
+		FirstName string `json:"first-name"`
+	}
+	err = tstruct.AddFuncMap[Dashed](make(template.FuncMap), tstruct.Naming(tstruct.JSONNames))
+	if err == nil {
+		t.Error("expected error for invalid json name")
+	}
+}
@@ -0,0 +1,129 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Nullable is implemented by pointers to "value plus valid flag" wrapper types,
+// such as a generic Optional[T].
+//
+// A field whose type is a nullable wrapper is set directly from the wrapped value:
+// (Name "x") sets the value and marks it valid.
+// database/sql's Null types, such as sql.NullString and sql.Null[T],
+// are recognized as nullable wrappers without implementing Nullable.
+// Other structs are never treated as nullable wrappers, whatever their fields.
+type Nullable interface {
+	// TStructNullable returns a pointer to the wrapped value and a pointer to the valid flag.
+	// Both must be non-nil.
+	TStructNullable() (value any, valid *bool)
+}
+
+var nullableType = reflect.TypeOf((*Nullable)(nil)).Elem()
+
+// A nullableDesc describes whether a struct type is a nullable wrapper.
+type nullableDesc struct {
+	value reflect.Type // the wrapped value's type, or nil if the struct is not a nullable wrapper
+	err   error        // non-nil if the struct implements Nullable incorrectly
+}
+
+var nullables sync.Map // struct type -> nullableDesc
+
+// describeNullable describes typ, caching the result.
+func describeNullable(typ reflect.Type) nullableDesc {
+	if typ.Kind() != reflect.Struct {
+		return nullableDesc{}
+	}
+	if d, ok := nullables.Load(typ); ok {
+		return d.(nullableDesc)
+	}
+	var d nullableDesc
+	val, _, err := nullableFields(reflect.New(typ))
+	switch {
+	case err != nil:
+		d.err = err
+	case val.IsValid():
+		d.value = val.Type()
+	}
+	nullables.Store(typ, d)
+	return d
+}
+
+// isNullable reports whether typ is a nullable wrapper type.
+func isNullable(typ reflect.Type) bool {
+	_, ok := nullableValueType(typ)
+	return ok
+}
+
+// nullableValueType returns the type of the value wrapped by typ,
+// and reports whether typ is a nullable wrapper type.
+func nullableValueType(typ reflect.Type) (reflect.Type, bool) {
+	d := describeNullable(typ)
+	return d.value, d.value != nil
+}
+
+// checkNullable returns an error if typ, the type of the field named name,
+// or one of its element types, implements Nullable incorrectly.
+func checkNullable(name string, typ reflect.Type) error {
+	for _, t := range nestedTypes(typ) {
+		if err := describeNullable(t).err; err != nil {
+			return fmt.Errorf("field %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// isSQLNull reports whether typ is one of database/sql's Null types.
+// It avoids importing database/sql.
+func isSQLNull(typ reflect.Type) bool {
+	return typ.PkgPath() == "database/sql" && strings.HasPrefix(typ.Name(), "Null")
+}
+
+// nullableFields returns the value and valid flag of the nullable wrapper that p points to.
+// It returns invalid Values if p does not point to a nullable wrapper,
+// and an error if *p implements Nullable incorrectly.
+func nullableFields(p reflect.Value) (val, valid reflect.Value, err error) {
+	if p.Type().Implements(nullableType) {
+		x, b := p.Interface().(Nullable).TStructNullable()
+		xv := reflect.ValueOf(x)
+		if xv.Kind() != reflect.Pointer || xv.IsNil() || b == nil {
+			return val, valid, fmt.Errorf("(%v).TStructNullable must return non-nil pointers, got %T and %T", p.Type(), x, b)
+		}
+		return xv.Elem(), reflect.ValueOf(b).Elem(), nil
+	}
+	v := p.Elem()
+	if !isSQLNull(v.Type()) {
+		return val, valid, nil
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Name == "Valid" {
+			valid = v.Field(i)
+		} else {
+			val = v.Field(i)
+		}
+	}
+	return val, valid, nil
+}
+
+// convertToNullable returns a valid value of the nullable wrapper type typ that wraps src,
+// for use as (part of) the value of the field named name.
+func (conv *converter) convertToNullable(name string, src reflect.Value, typ reflect.Type) reflect.Value {
+	p := reflect.New(typ)
+	val, valid, err := nullableFields(p)
+	if err != nil {
+		panic(err.Error())
+	}
+	conv.convertAndSet(name, val, src)
+	valid.SetBool(true)
+	return p.Elem()
+}
+
+// isBool reports whether typ is a bool type or a nullable wrapper around one.
+func isBool(typ reflect.Type) bool {
+	if vt, ok := nullableValueType(typ); ok {
+		typ = vt
+	}
+	return typ.Kind() == reflect.Bool
+}
@@ -0,0 +1,102 @@
+package tstruct_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+// Optional has unexported fields, so it implements tstruct.Nullable.
+type Optional[T any] struct {
+	v  T
+	ok bool
+}
+
+func (o *Optional[T]) TStructNullable() (any, *bool) { return &o.v, &o.ok }
+
+// Maybe has exported fields, but is only a nullable wrapper because it implements tstruct.Nullable.
+type Maybe[T any] struct {
+	Value T
+	Valid bool
+}
+
+func (m *Maybe[T]) TStructNullable() (any, *bool) { return &m.Value, &m.Valid }
+
+type Row struct {
+	Name    sql.NullString
+	Age     sql.NullInt64
+	Admin   sql.NullBool
+	Score   Optional[float64]
+	Level   Maybe[Level]
+	Aliases []sql.NullString
+	Note    sql.Null[string]
+}
+
+func TestNullable(t *testing.T) {
+	want := Row{
+		Name:    sql.NullString{String: "x", Valid: true},
+		Age:     sql.NullInt64{Int64: 42, Valid: true},
+		Admin:   sql.NullBool{Bool: true, Valid: true},
+		Score:   Optional[float64]{v: 1, ok: true},
+		Level:   Maybe[Level]{Value: Warn, Valid: true},
+		Aliases: []sql.NullString{{String: "y", Valid: true}},
+		Note:    sql.Null[string]{V: "n", Valid: true},
+	}
+	const tmpl = `{{ yield (Row (Name "x") (Age 42) (Admin) (Score 1) (Level "warn") (Aliases "y") (Note "n")) }}`
+	testOneWith(t, loggerEnums, want, tmpl)
+	// Unset wrappers remain invalid.
+	testOne(t, Row{Age: sql.NullInt64{Valid: true}}, `{{ yield (Row (Age 0)) }}`)
+	// Wrappers can also be passed in whole.
+	testOne(t, Row{Name: sql.NullString{String: "z"}}, `{{ yield (Row (Name .)) }}`, sql.NullString{String: "z"})
+	testOneWantErrStrs(t, Row{}, `{{ yield (Row (Age "x")) }}`, []string{"cannot use string as int64 in Age"})
+}
+
+func TestNullableNotRegistered(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Row](m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"NullString", "NullInt64", "Valid", "String", "Int64"} {
+		if _, ok := m[name]; ok {
+			t.Errorf("unexpected FuncMap entry %s", name)
+		}
+	}
+}
+
+func TestNullableLookalike(t *testing.T) {
+	type Check struct {
+		Name  string
+		Valid bool
+	}
+	type Setting struct {
+		Value string
+		Valid bool
+	}
+	type Report struct {
+		Result  Check
+		Setting Setting `tstruct:"name=Set"`
+	}
+	// Check and Setting are ordinary structs, not nullable wrappers.
+	want := Report{Result: Check{Name: "x", Valid: true}, Setting: Setting{Value: "v"}}
+	testOne(t, want, `{{ yield (Report (Result (Check (Name "x") (Valid))) (Set (Setting (Value "v")))) }}`)
+}
+
+type badNullable struct{ v int }
+
+func (b *badNullable) TStructNullable() (any, *bool) { return b.v, nil }
+
+func TestNullableBadImplementation(t *testing.T) {
+	type Bad struct {
+		Field  badNullable
+		Fields []badNullable
+	}
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Bad](m)
+	if err == nil || !strings.Contains(err.Error(), "TStructNullable must return non-nil pointers") {
+		t.Fatalf("got %v, want TStructNullable error", err)
+	}
+}
@@ -0,0 +1,174 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// An Option configures a call to AddFuncMap.
+type Option func(*config)
+
+type config struct {
+	top     reflect.Type // the struct type passed to AddFuncMap
+	name    string       // template-visible name for top, if non-empty
+	qualify bool         // qualify type names with their package name
+	depth   int          // maximum depth of automatically registered nested types; -1 means unlimited
+
+	exposedOnly bool  // only fields tagged expose get setters
+	namer       Namer // nil means use Go names
+
+	onDeprecated func(DeprecatedUse) // called for each use of a deprecated setter
+
+	resolver Resolver // nil means FailOnConflict
+	report   *Report  // if non-nil, records the constructors added
+	generic  bool     // add the generic funcs New and Set
+
+	conv *converter // converts template values for fields; configured by Implements, Func, and Enum
+
+	err error // the first error from an option
+}
+
+func newConfig(top reflect.Type, opts []Option) *config {
+	cfg := &config{top: top, depth: -1, conv: new(converter)}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Name sets the name of the constructor for the type passed to AddFuncMap,
+// instead of deriving it from the type's Go name.
+// Name does not affect automatically registered nested types.
+func Name(name string) Option {
+	return func(cfg *config) { cfg.name = name }
+}
+
+// QualifyNames qualifies the names of all struct constructors added by AddFuncMap
+// with the name of the package that declares the struct, as in api_User.
+// Use it to register same-named struct types from different packages.
+// The Name option takes precedence over QualifyNames.
+func QualifyNames() Option {
+	return func(cfg *config) { cfg.qualify = true }
+}
+
+// MaxDepth limits automatic registration of nested types
+// to those at most n levels of nesting below the type passed to AddFuncMap.
+// MaxDepth(0) registers only the type passed to AddFuncMap.
+// Fields whose types are not registered can still be set from template data.
+// To prevent registration for a single field, tag it tstruct:"noreg".
+func MaxDepth(n int) Option {
+	return func(cfg *config) { cfg.depth = n }
+}
+
+// ExposedOnly makes fields settable only if they are explicitly tagged tstruct:"expose",
+// instead of all exported fields that are not tagged tstruct:"-".
+// It applies to automatically registered nested types as well.
+// A nested type that is already registered with the opposite policy is an error.
+// Use it for types whose templates are not fully trusted,
+// so that adding an exported field does not silently make it settable.
+func ExposedOnly() Option {
+	return func(cfg *config) { cfg.exposedOnly = true }
+}
+
+// Naming sets the strategy used to derive template-visible names from Go names,
+// for struct constructors and field setters alike,
+// including those of automatically registered nested types.
+// The Name option and name= field tags take precedence.
+func Naming(n Namer) Option {
+	return func(cfg *config) { cfg.namer = n }
+}
+
+// OnDeprecated sets a hook to be called each time a template uses the setter for a deprecated field.
+// A field tagged tstruct:"deprecated=NewName" keeps its setter,
+// but the setter sets the field NewName instead.
+// Use the hook to measure remaining use of the old name before removing the field.
+// To learn which template used the setter, use ForTemplate.
+// The hook may be called concurrently, if templates are executed concurrently.
+func OnDeprecated(hook func(DeprecatedUse)) Option {
+	return func(cfg *config) { cfg.onDeprecated = hook }
+}
+
+// OnConflict sets the Resolver used when a struct constructor's name is already in use,
+// by another struct type's constructor, by a field setter, or by another FuncMap entry.
+// A nested type's name that is also the name of one of its parent's fields, as in Route Route, counts as in use.
+// Only constructor names are resolved: a field setter whose name is already used by a constructor,
+// for example that of a type registered earlier, is still an error. Use a name= tag to rename the field.
+// The default is FailOnConflict.
+// tstruct provides QualifyWithParent and SkipNested; use ReportTo to see what was decided.
+func OnConflict(r Resolver) Option {
+	return func(cfg *config) { cfg.resolver = r }
+}
+
+// ReportTo makes the registration describe the struct constructors it adds, with their final names, in rep.
+// Any previous contents of rep are discarded.
+// If the registration fails, rep may be incomplete.
+func ReportTo(rep *Report) Option {
+	return func(cfg *config) {
+		*rep = Report{}
+		cfg.report = rep
+	}
+}
+
+// GenericFuncs adds the generic funcs New and Set,
+// which reach constructors and setters by name: (New "Server" ...) and (Set "Port" 8080).
+// New accepts constructor names and Go type names, such as "Server" or "api.Server".
+// Set dispatches between struct types just like the setter it names.
+// Once added, New and Set stay for all later registrations.
+// Then constructors and setters whose names are already in use are not an error:
+// they are only available through New and Set.
+// A constructor whose name is another struct type's constructor is only available
+// through New by its qualified Go type name, such as "other.Server".
+// An OnConflict Resolver, if any, takes precedence for constructors.
+func GenericFuncs() Option {
+	return func(cfg *config) { cfg.generic = true }
+}
+
+// fail records err, an error from an option, to be returned by the registration.
+// Only the first error is kept.
+func (cfg *config) fail(err error) {
+	if cfg.err == nil {
+		cfg.err = err
+	}
+}
+
+// fieldName returns the default template-visible name of the field f.
+func (cfg *config) fieldName(f reflect.StructField) string {
+	if cfg.namer == nil {
+		return f.Name
+	}
+	return cfg.namer(f.Name, &f)
+}
+
+// registerDepth reports whether nested types at the given depth should be registered.
+func (cfg *config) registerDepth(depth int) bool {
+	return cfg.depth < 0 || depth <= cfg.depth
+}
+
+// typeName returns the template-visible name of the struct type rt.
+func (cfg *config) typeName(rt reflect.Type) (string, error) {
+	name := rt.Name()
+	if rt == cfg.top && cfg.name != "" {
+		name = cfg.name
+	} else {
+		if generic, ok := genericTypeName(name); ok {
+			name = generic
+		}
+		if cfg.namer != nil {
+			name = cfg.namer(name, nil)
+		}
+		if cfg.qualify {
+			// rt.String is qualified by package name (not path).
+			pkg, _, _ := strings.Cut(rt.String(), ".")
+			name = pkg + "_" + name
+		}
+	}
+	if !isTemplateIdent(name) {
+		if rt != cfg.top {
+			// The Name option only applies to the type passed to AddFuncMap.
+			return "", fmt.Errorf("%v: %q is not a valid template func name; tag the fields of this type noreg, or register it explicitly with the Name option first", rt, name)
+		}
+		return "", fmt.Errorf("%v: %q is not a valid template func name; use the Name option to choose one", rt, name)
+	}
+	return name, nil
+}
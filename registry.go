@@ -0,0 +1,584 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// A Registry holds struct types registered for use in templates,
+// along with their constructors and field setters.
+// Use Register to add types and FuncMap to use them in templates.
+//
+// A Registry is safe for concurrent use.
+// The zero value is an empty Registry.
+type Registry struct {
+	mu sync.Mutex
+	st *registryState // nil means empty
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+// Register adds constructors for T to r, with the same semantics as AddFuncMap.
+// If Register returns a non-nil error, r is unmodified.
+func Register[T any](r *Registry, opts ...Option) error {
+	var t T
+	return r.RegisterType(reflect.TypeOf(t), opts...)
+}
+
+// RegisterType is like Register, but takes the type to register as a reflect.Type,
+// as AddFuncMapType does.
+func (r *Registry) RegisterType(typ reflect.Type, opts ...Option) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.state().clone()
+	err := registerType(st, typ, opts)
+	if err != nil {
+		return err
+	}
+	r.st = st
+	return nil
+}
+
+// FuncMap returns a new FuncMap containing the constructors and field setters for r's types.
+// Later changes to r do not affect the returned FuncMap.
+func (r *Registry) FuncMap() map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state().funcMap()
+}
+
+// Remove removes the struct type typ from r.
+// If typ is a pointer type, its element type is removed.
+// Struct types that were registered automatically for use in typ's fields are removed too,
+// unless they are used by a type that remains.
+// If typ is itself used by a type that remains, it stays available to templates,
+// until the last type that uses it is removed.
+// Field setters shared with remaining types keep working for them.
+func (r *Registry) Remove(typ reflect.Type) error {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.state().clone()
+	found := false
+	for name, info := range st.ctors {
+		if info.typ != typ {
+			continue
+		}
+		found = true
+		if !info.nested {
+			st.ctors[name] = info.withNested(true)
+		}
+	}
+	if !found {
+		return fmt.Errorf("%v is not registered", typ)
+	}
+	st.collect()
+	r.st = st
+	return nil
+}
+
+// collect removes all automatically registered struct types
+// that are not used by an explicitly registered type, directly or indirectly,
+// along with their field setters.
+func (st *registryState) collect() {
+	byType := make(map[reflect.Type][]*structInfo)
+	live := make(map[reflect.Type]bool)
+	var work []reflect.Type
+	for _, info := range st.ctors {
+		byType[info.typ] = append(byType[info.typ], info)
+		if !info.nested && !live[info.typ] {
+			live[info.typ] = true
+			work = append(work, info.typ)
+		}
+	}
+	for len(work) > 0 {
+		typ := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, info := range byType[typ] {
+			for _, dep := range info.deps {
+				if !live[dep] {
+					live[dep] = true
+					work = append(work, dep)
+				}
+			}
+		}
+	}
+	for name, info := range st.ctors {
+		if !live[info.typ] {
+			delete(st.ctors, name)
+		}
+	}
+	for name, t := range st.setters {
+		if t = t.retain(live); t == nil {
+			delete(st.setters, name)
+		} else {
+			st.setters[name] = t
+		}
+	}
+}
+
+// state returns r's state. r.mu must be held.
+func (r *Registry) state() *registryState {
+	if r.st == nil {
+		r.st = newRegistryState()
+	}
+	return r.st
+}
+
+// registerType adds constructors for typ to st.
+func registerType(st *registryState, typ reflect.Type, opts []Option) error {
+	if typ == nil {
+		return fmt.Errorf("nil type")
+	}
+	rt := typ
+	if rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return fmt.Errorf("non-struct type %v", rt)
+	}
+	cfg := newConfig(rt, opts)
+	if cfg.err != nil {
+		return cfg.err
+	}
+	if cfg.generic {
+		err := st.enableGeneric()
+		if err != nil {
+			return err
+		}
+	}
+	return addStructFuncs(typ, st, cfg, 0, nil)
+}
+
+// registryState is the contents of a Registry.
+// Its maps may be modified only while it is private to a single registration;
+// the structInfos and setterTables they refer to are never modified once registered.
+type registryState struct {
+	ctors    map[string]*structInfo  // constructor name -> struct
+	setters  map[string]*setterTable // setter name -> dispatch table
+	others   map[string]any          // FuncMap entries not generated by tstruct
+	generic  bool                    // whether to include the generic funcs New and Set
+	template string                  // the template name reported by deprecated setters; see ForTemplate
+
+	// conflicts, if non-nil, collects conflicts instead of failing at the first one.
+	// See conflict.
+	conflicts *[]Conflict
+	// conflicted holds the struct types whose constructors were recorded in conflicts.
+	conflicted map[reflect.Type]bool
+}
+
+func newRegistryState() *registryState {
+	return &registryState{
+		ctors:   make(map[string]*structInfo),
+		setters: make(map[string]*setterTable),
+		others:  make(map[string]any),
+	}
+}
+
+// clone returns a copy of st that can be modified without affecting st.
+func (st *registryState) clone() *registryState {
+	c := newRegistryState()
+	for k, v := range st.ctors {
+		c.ctors[k] = v
+	}
+	for k, v := range st.setters {
+		c.setters[k] = v
+	}
+	for k, v := range st.others {
+		c.others[k] = v
+	}
+	c.generic = st.generic
+	c.template = st.template
+	return c
+}
+
+// loadFuncMap returns the registry state described by fnmap.
+// Entries added to fnmap by tstruct are recognized by their types, which only tstruct creates,
+// and then queried for their contents; all other entries are kept as is, without calling them.
+func loadFuncMap(fnmap map[string]any) *registryState {
+	st := newRegistryState()
+	generic := make(map[string]*registryState) // generic func name -> its registry state
+	for name, x := range fnmap {
+		if info := queryCtor(x); info != nil {
+			st.ctors[name] = info
+			continue
+		}
+		if t, template := querySetter(x); t != nil {
+			st.setters[name] = t
+			st.template = template
+			continue
+		}
+		if g := queryGeneric(x); g != nil {
+			generic[name] = g
+			continue
+		}
+		st.others[name] = x
+	}
+	// Hidden entries are only reachable through the generic funcs.
+	// New and Set may come from different registries, so gather them from both,
+	// in a fixed order, so that the first one wins any disagreement.
+	names := make([]string, 0, len(generic))
+	for name := range generic {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	st.generic = len(names) > 0
+	for _, gname := range names {
+		g := generic[gname]
+		if st.template == "" {
+			st.template = g.template
+		}
+		for name, info := range g.ctors {
+			if _, ok := st.ctors[name]; !ok && info.hidden {
+				st.ctors[name] = info
+			}
+		}
+		for name, t := range g.setters {
+			if !t.hidden {
+				continue
+			}
+			prev, ok := st.setters[name]
+			switch {
+			case !ok:
+				st.setters[name] = t
+			case prev.hidden:
+				for _, e := range t.entries {
+					if prev.lookup(e.typ) == nil {
+						prev = prev.with(e)
+					}
+				}
+				st.setters[name] = prev
+			}
+		}
+	}
+	return st
+}
+
+// funcMap returns a FuncMap containing all of st's entries.
+func (st *registryState) funcMap() map[string]any {
+	m := make(map[string]any, len(st.ctors)+len(st.setters)+len(st.others))
+	for name, x := range st.others {
+		m[name] = x
+	}
+	for name, info := range st.ctors {
+		if !info.hidden {
+			m[name] = info.ctor
+		}
+	}
+	for name, t := range st.setters {
+		if !t.hidden {
+			m[name] = t.savedApplyFn(name, st.template)
+		}
+	}
+	if st.generic {
+		m["New"] = st.newFunc()
+		m["Set"] = st.setFunc()
+	}
+	return m
+}
+
+// writeFuncMap makes base, from which st was loaded, contain st's entries.
+// Entries that st no longer has, such as setters for fields that are no longer settable, are deleted.
+func (st *registryState) writeFuncMap(base map[string]any) {
+	m := st.funcMap()
+	for name := range base {
+		if _, ok := m[name]; !ok {
+			delete(base, name)
+		}
+	}
+	for name, x := range m {
+		base[name] = x
+	}
+}
+
+// checkUnused returns an error if name is in use in st.
+// Hidden entries do not use their names.
+func (st *registryState) checkUnused(name string) error {
+	if info, ok := st.ctors[name]; ok && !info.hidden {
+		return fmt.Errorf("conflicting FuncMap entries for %s: already used as the constructor for %v", name, info.typ)
+	}
+	return st.checkUnusedByNonCtor(name)
+}
+
+// checkUnusedByNonCtor is like checkUnused, but ignores constructors.
+func (st *registryState) checkUnusedByNonCtor(name string) error {
+	if st.generic && isGenericName(name) {
+		return fmt.Errorf("conflicting FuncMap entries for %s: already used as a generic func", name)
+	}
+	if t, ok := st.setters[name]; ok && !t.hidden {
+		return fmt.Errorf("conflicting FuncMap entries for %s: already used as a field setter", name)
+	}
+	if x, ok := st.others[name]; ok {
+		return fmt.Errorf("conflicting FuncMap entries for %s: %T", name, x)
+	}
+	return nil
+}
+
+// checkCtorName returns an error if name is in use in st,
+// other than by a constructor for typ.
+func (st *registryState) checkCtorName(name string, typ reflect.Type) error {
+	if prev, ok := st.ctors[name]; ok && prev.typ != typ {
+		return fmt.Errorf("conflicting FuncMap entries for %s: constructors for %v and %v (use the QualifyNames or Name option to disambiguate)", name, prev.typ, typ)
+	}
+	return st.checkUnusedByNonCtor(name)
+}
+
+// ctorFor returns the structInfo for a constructor for typ, or nil if there is none.
+func (st *registryState) ctorFor(typ reflect.Type) *structInfo {
+	for _, info := range st.ctors {
+		if info.typ == typ {
+			return info
+		}
+	}
+	return nil
+}
+
+// addSetter adds e, a setter for a field of struct type e.typ, to st under name.
+// If name is already a setter for other struct types, e joins its dispatch table.
+// If name is otherwise in use, and st has generic funcs, the setter is hidden:
+// it is only available through Set.
+func (st *registryState) addSetter(name string, e setterEntry) error {
+	typ := e.typ
+	t, ok := st.setters[name]
+	if !ok {
+		err := st.checkUnused(name)
+		switch {
+		case err == nil:
+			// OK
+		case st.generic:
+			t = &setterTable{hidden: true}
+		default:
+			return st.conflict(name, "a field setter for "+typ.String(), typ, err)
+		}
+	}
+	st.setters[name] = t.with(e)
+	return nil
+}
+
+// dropSetters removes the setters for fields of the struct type typ from st.
+func (st *registryState) dropSetters(typ reflect.Type) {
+	for name, t := range st.setters {
+		if t.lookup(typ) == nil {
+			continue
+		}
+		if t = t.without(typ); t == nil {
+			delete(st.setters, name)
+		} else {
+			st.setters[name] = t
+		}
+	}
+}
+
+// structInfo describes a registered struct type.
+type structInfo struct {
+	typ         reflect.Type   // the struct type (never a pointer)
+	name        string         // constructor name
+	ctor        any            // constructor
+	nested      bool           // registered automatically, as part of another struct type
+	hidden      bool           // only available through New, because name is in use
+	exposedOnly bool           // registered with the ExposedOnly option
+	conv        *converter     // converts template values for the fields
+	fields      []fieldInfo    // settable fields, in declaration order
+	deps        []reflect.Type // struct types registered automatically for use in fields
+
+	// wrap returns a constructor that answers queries with info.
+	wrap func(info *structInfo) any
+}
+
+// withNested returns a copy of info with its nested flag set to nested.
+func (info *structInfo) withNested(nested bool) *structInfo {
+	c := *info
+	c.nested = nested
+	c.ctor = c.wrap(&c)
+	return &c
+}
+
+// hasField reports whether name is the template-visible name of one of info's fields.
+func (info *structInfo) hasField(name string) bool {
+	for _, f := range info.fields {
+		for _, n := range append([]string{f.tag.name}, f.tag.aliases...) {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldInfo describes a settable field of a registered struct type.
+type fieldInfo struct {
+	field reflect.StructField
+	tag   fieldTag // includes the field's template-visible names
+}
+
+// ctorQuery is a special sentinel type that struct constructors recognize.
+// When passed a *ctorQuery as their only arg,
+// struct constructors record their structInfo in it
+// and return a zero value, without doing any further work.
+type ctorQuery struct {
+	info *structInfo
+}
+
+// isCtorQuery reports whether args is a request for a struct constructor to describe itself.
+// If so, it returns the query to fill in.
+func isCtorQuery(args []reflect.Value) (*ctorQuery, bool) {
+	if len(args) != 1 {
+		return nil, false
+	}
+	q, ok := devirt(args[0]).Interface().(*ctorQuery)
+	return q, ok
+}
+
+// queryCtor returns the structInfo for x,
+// or nil if x is not a struct constructor generated by tstruct.
+// It only calls x if x is known to be such a constructor.
+func queryCtor(x any) *structInfo {
+	// Check whether x is a func(args ...ctorArg) T for any T.
+	// Only tstruct can make such funcs, so it is safe to ask it what it constructs.
+	xfn := reflect.ValueOf(x)
+	if xfn.Kind() != reflect.Func {
+		return nil
+	}
+	xType := xfn.Type()
+	if xType.NumIn() != 1 || xType.NumOut() != 1 || !xType.IsVariadic() {
+		return nil
+	}
+	in := xType.In(0)
+	if in.Kind() != reflect.Slice || in.Elem() != ctorArgType {
+		return nil
+	}
+	q := new(ctorQuery)
+	xfn.Call([]reflect.Value{reflect.ValueOf(q)})
+	return q.info
+}
+
+// A setterTable holds the setters sharing a single name,
+// one for each struct type that has a field with that name.
+// setterTables are immutable; use with to make modified copies.
+type setterTable struct {
+	entries []setterEntry // in registration order
+	hidden  bool          // only available through Set, because the name is in use
+}
+
+type setterEntry struct {
+	typ reflect.Type // the struct type
+	fn  savedApplyFn
+	dep *deprecation // non-nil if the setter is deprecated
+}
+
+// with returns a copy of t in which e is the setter for e.typ.
+// t may be nil.
+func (t *setterTable) with(e setterEntry) *setterTable {
+	c := new(setterTable)
+	if t != nil {
+		c.hidden = t.hidden
+		c.entries = make([]setterEntry, 0, len(t.entries)+1)
+		for _, prev := range t.entries {
+			if prev.typ != e.typ {
+				c.entries = append(c.entries, prev)
+			}
+		}
+	}
+	c.entries = append(c.entries, e)
+	return c
+}
+
+// without returns a copy of t without the setter for typ,
+// or nil if there would be none left.
+func (t *setterTable) without(typ reflect.Type) *setterTable {
+	c := &setterTable{hidden: t.hidden}
+	for _, e := range t.entries {
+		if e.typ != typ {
+			c.entries = append(c.entries, e)
+		}
+	}
+	if len(c.entries) == 0 {
+		return nil
+	}
+	return c
+}
+
+// lookup returns the setter in t for typ, or nil if there is none.
+func (t *setterTable) lookup(typ reflect.Type) savedApplyFn {
+	for _, e := range t.entries {
+		if e.typ == typ {
+			return e.fn
+		}
+	}
+	return nil
+}
+
+// retain returns a copy of t containing only the setters for the types in keep,
+// or nil if there are none.
+func (t *setterTable) retain(keep map[reflect.Type]bool) *setterTable {
+	c := &setterTable{hidden: t.hidden}
+	for _, e := range t.entries {
+		if keep[e.typ] {
+			c.entries = append(c.entries, e)
+		}
+	}
+	if len(c.entries) == 0 {
+		return nil
+	}
+	return c
+}
+
+// setterQuery is a special sentinel type that setters generated by setterTable.savedApplyFn recognize.
+// When an applyFn from such a setter is applied to a *setterQuery,
+// it records the setter's table and template name in it, without doing any further work.
+type setterQuery struct {
+	t        *setterTable
+	template string
+}
+
+var setterQueryType = reflect.TypeOf((*setterQuery)(nil))
+
+// querySetter returns the setterTable for x, and the template name it reports deprecated uses with,
+// or nil if x is not a field setter generated by tstruct.
+// It only calls x if x is such a setter.
+func querySetter(x any) (*setterTable, string) {
+	fn, ok := x.(setterFunc)
+	if !ok {
+		return nil, ""
+	}
+	q := new(setterQuery)
+	fn()(reflect.ValueOf(q))
+	return q.t, q.template
+}
+
+// savedApplyFn returns a setter named name that dispatches to
+// the setter in t for the type of struct it is applied to.
+// Deprecated setters report their uses by the template named template.
+func (t *setterTable) savedApplyFn(name, template string) setterFunc {
+	byType := make(map[reflect.Type]setterEntry, len(t.entries))
+	for _, e := range t.entries {
+		byType[e.typ] = e
+	}
+	return func(args ...reflect.Value) applyFn {
+		return func(dst reflect.Value) {
+			if dst.Type() == setterQueryType {
+				q := dst.Interface().(*setterQuery)
+				q.t, q.template = t, template
+				return
+			}
+			// Requests to mark fields as set are dispatched like everything else,
+			// because name might be an alias, known by a different name to the required field tracking.
+			typ := applyTargetType(dst)
+			e, ok := byType[typ]
+			if !ok {
+				panic(fmt.Sprintf("%s is not a field of %v", name, typ))
+			}
+			if e.dep != nil && dst.Type() != fieldsAreUnsetType {
+				e.dep.report(template)
+			}
+			e.fn(args...)(dst)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package tstruct_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Listener struct {
+	Addr string `tstruct:"+"`
+	Port int
+}
+
+type Backend struct {
+	Addr   string
+	Weight int
+}
+
+func execRegistry(t *testing.T, r *tstruct.Registry, tmpl string) string {
+	t.Helper()
+	m := r.FuncMap()
+	m["show"] = func(x any) string { return fmt.Sprintf("%+v", x) }
+	p, err := template.New("test").Funcs(m).Parse(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	err = p.Execute(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestRegistry(t *testing.T) {
+	var r tstruct.Registry
+	if err := tstruct.Register[Listener](&r); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.Register[Backend](&r); err != nil {
+		t.Fatal(err)
+	}
+	// Registering a type again is fine, even when it has required fields.
+	if err := tstruct.Register[Listener](&r); err != nil {
+		t.Fatal(err)
+	}
+	got := execRegistry(t, &r, `{{ show (Listener (Addr "a") (Port 1)) }} {{ show (Backend (Addr "b") (Weight 2)) }}`)
+	want := "{Addr:a Port:1} {Addr:b Weight:2}"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRegistryConflict(t *testing.T) {
+	type Port struct{}
+	r := tstruct.NewRegistry()
+	if err := tstruct.Register[Listener](r); err != nil {
+		t.Fatal(err)
+	}
+	before := len(r.FuncMap())
+	err := tstruct.Register[Port](r)
+	if err == nil || !strings.Contains(err.Error(), "field setter") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	// The failed registration left r unmodified.
+	if after := len(r.FuncMap()); after != before {
+		t.Fatal("failed registration modified the Registry")
+	}
+}
+
+func TestRegistryFuncMapIsSnapshot(t *testing.T) {
+	r := tstruct.NewRegistry()
+	if err := tstruct.Register[Listener](r); err != nil {
+		t.Fatal(err)
+	}
+	m := r.FuncMap()
+	if err := tstruct.Register[Backend](r); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["Backend"]; ok {
+		t.Fatal("FuncMap changed after later registration")
+	}
+	// Setters in m dispatch only to the types registered when m was created.
+	p := template.Must(template.New("test").Funcs(r.FuncMap()).Funcs(m).Parse(`{{ Backend (Addr "b") }}`))
+	err := p.Execute(&strings.Builder{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "Addr is not a field of tstruct_test.Backend") {
+		t.Fatalf("expected dispatch error, got %v", err)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	type A struct{ Name string }
+	type B struct{ Name int }
+	type C struct{ Name bool }
+	r := tstruct.NewRegistry()
+	regs := []func(*tstruct.Registry, ...tstruct.Option) error{
+		tstruct.Register[A],
+		tstruct.Register[B],
+		tstruct.Register[C],
+		tstruct.Register[Listener],
+		tstruct.Register[Backend],
+	}
+	var wg sync.WaitGroup
+	for _, reg := range regs {
+		wg.Add(1)
+		go func(reg func(*tstruct.Registry, ...tstruct.Option) error) {
+			defer wg.Done()
+			if err := reg(r); err != nil {
+				t.Error(err)
+			}
+			r.FuncMap()
+		}(reg)
+	}
+	wg.Wait()
+	got := execRegistry(t, r, `{{ show (A (Name "x")) }} {{ show (B (Name 1)) }} {{ show (C (Name)) }}`)
+	want := "{Name:x} {Name:1} {Name:true}"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestAddFuncMapUsesRegistryFuncMap(t *testing.T) {
+	type A struct{ Name string }
+	type B struct{ Name int }
+	r := tstruct.NewRegistry()
+	if err := tstruct.Register[A](r); err != nil {
+		t.Fatal(err)
+	}
+	m := r.FuncMap()
+	if err := tstruct.AddFuncMap[B](m); err != nil {
+		t.Fatal(err)
+	}
+	m["show"] = func(x any) string { return fmt.Sprintf("%+v", x) }
+	var buf strings.Builder
+	p := template.Must(template.New("test").Funcs(m).Parse(`{{ show (A (Name "x")) }} {{ show (B (Name 1)) }}`))
+	if err := p.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "{Name:x} {Name:1}"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestAddFuncMapDoesNotCallOtherFuncs(t *testing.T) {
+	type A struct{ Name string }
+	var calls []string
+	m := template.FuncMap{
+		"count": func(args ...reflect.Value) int {
+			calls = append(calls, "count")
+			return len(args)
+		},
+		"apply": func(args ...reflect.Value) func(reflect.Value) {
+			calls = append(calls, "apply")
+			return nil
+		},
+	}
+	if err := tstruct.AddFuncMap[A](m); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Backend](m); err != nil {
+		t.Fatal(err)
+	}
+	if calls != nil {
+		t.Errorf("AddFuncMap called %v", calls)
+	}
+	if len(tstruct.FromFuncMap(m).Structs()) != 2 {
+		t.Errorf("got structs %v, want A and Backend", tstruct.FromFuncMap(m).Structs())
+	}
+	for _, name := range []string{"count", "apply"} {
+		if m[name] == nil {
+			t.Errorf("lost FuncMap entry %s", name)
+		}
+	}
+}
+
+func TestRegistryRemove(t *testing.T) {
+	type Pool struct {
+		Members []Backend
+	}
+	r := tstruct.NewRegistry()
+	for _, reg := range []func(*tstruct.Registry, ...tstruct.Option) error{
+		tstruct.Register[Listener],
+		tstruct.Register[Route],
+		tstruct.Register[Pool],
+	} {
+		if err := reg(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	routeType, poolType := reflect.TypeOf(Route{}), reflect.TypeOf(Pool{})
+
+	// Backend is still used by Pool.
+	if err := r.Remove(routeType); err != nil {
+		t.Fatal(err)
+	}
+	m := r.FuncMap()
+	if _, ok := m["Route"]; ok {
+		t.Error("Route not removed")
+	}
+	if _, ok := m["Path"]; ok {
+		t.Error("Path not removed")
+	}
+	got := execRegistry(t, r, `{{ show (Listener (Addr "a")) }} {{ show (Pool (Members (Backend (Addr "b") (Weight 1)))) }}`)
+	if want := "{Addr:a Port:0} {Members:[{Addr:b Weight:1}]}"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Now nothing uses Backend.
+	if err := r.Remove(reflect.PtrTo(poolType)); err != nil {
+		t.Fatal(err)
+	}
+	m = r.FuncMap()
+	for _, name := range []string{"Pool", "Members", "Backend", "Weight"} {
+		if _, ok := m[name]; ok {
+			t.Errorf("%s not removed", name)
+		}
+	}
+	got = execRegistry(t, r, `{{ show (Listener (Addr "a") (Port 1)) }}`)
+	if want := "{Addr:a Port:1}"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if err := r.Remove(routeType); err == nil {
+		t.Error("expected error removing unregistered type")
+	}
+}
+
+func TestRegistryRemoveStillUsed(t *testing.T) {
+	r := tstruct.NewRegistry()
+	if err := tstruct.Register[Backend](r); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.Register[Route](r); err != nil {
+		t.Fatal(err)
+	}
+	// Route still uses Backend, so it stays, until Route is removed.
+	if err := r.Remove(reflect.TypeOf(Backend{})); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.FuncMap()["Backend"]; !ok {
+		t.Fatal("Backend removed while still in use")
+	}
+	// The FuncMap remembers that Backend is no longer explicitly registered.
+	r = tstruct.FromFuncMap(r.FuncMap())
+	if err := r.Remove(reflect.TypeOf(Route{})); err != nil {
+		t.Fatal(err)
+	}
+	if m := r.FuncMap(); len(m) != 0 {
+		t.Fatalf("expected empty FuncMap, got %v", m)
+	}
+}
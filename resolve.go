@@ -0,0 +1,92 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A NameConflict describes a struct constructor whose name is already in use.
+type NameConflict struct {
+	Name       string       // the contested name
+	Type       reflect.Type // the struct type being registered
+	Parent     reflect.Type // the struct type with a field that uses Type, or nil if Type was passed to AddFuncMap
+	ParentName string       // the constructor name of Parent
+	Existing   string       // the existing use of Name, such as "a field setter for api.User"
+
+	err error // the error to report if the conflict is not resolved
+}
+
+// A Resolver decides what to do about a NameConflict.
+// It returns the constructor name to use instead,
+// or "" to skip registering a nested type (the fields that use it can still be set from template data),
+// or an error to fail the registration.
+type Resolver func(c NameConflict) (string, error)
+
+// FailOnConflict is a Resolver that fails the registration. It is the default.
+func FailOnConflict(c NameConflict) (string, error) {
+	return "", c.err
+}
+
+// QualifyWithParent is a Resolver that prefixes a nested type's name with its parent's,
+// as in Route_Backend.
+// It fails if the type was passed to AddFuncMap.
+func QualifyWithParent(c NameConflict) (string, error) {
+	if c.Parent == nil {
+		return FailOnConflict(c)
+	}
+	return c.ParentName + "_" + c.Name, nil
+}
+
+// SkipNested is a Resolver that skips registering a nested type.
+// It fails if the type was passed to AddFuncMap.
+func SkipNested(c NameConflict) (string, error) {
+	if c.Parent == nil {
+		return FailOnConflict(c)
+	}
+	return "", nil
+}
+
+// A Report lists the struct constructors added by a registration.
+type Report struct {
+	Constructors []ReportEntry // in registration order
+}
+
+// A ReportEntry describes a struct constructor added by a registration.
+type ReportEntry struct {
+	Type     reflect.Type
+	Name     string // the constructor's final name, or "" if the type was skipped
+	Nested   bool   // registered automatically, because another registered type uses it
+	Conflict string // if non-empty, the contested name that was resolved
+	Hidden   bool   // the constructor is only available through New, because Conflict is in use
+}
+
+func (e ReportEntry) String() string {
+	switch {
+	case e.Hidden:
+		return fmt.Sprintf("%v: only through New (%s is taken)", e.Type, e.Conflict)
+	case e.Conflict == "":
+		return fmt.Sprintf("%v: %s", e.Type, e.Name)
+	case e.Name == "":
+		return fmt.Sprintf("%v: skipped (%s is taken)", e.Type, e.Conflict)
+	}
+	return fmt.Sprintf("%v: %s (%s is taken)", e.Type, e.Name, e.Conflict)
+}
+
+// resolve resolves c, using cfg's Resolver.
+func (cfg *config) resolve(c NameConflict) (string, error) {
+	if cfg.resolver == nil {
+		return FailOnConflict(c)
+	}
+	name, err := cfg.resolver(c)
+	if err == nil && name == "" && c.Parent == nil {
+		err = fmt.Errorf("%v: cannot skip the type passed to AddFuncMap (conflict over %s)", c.Type, c.Name)
+	}
+	return name, err
+}
+
+// record adds e to cfg's report, if any.
+func (cfg *config) record(e ReportEntry) {
+	if cfg.report != nil {
+		cfg.report.Constructors = append(cfg.report.Constructors, e)
+	}
+}
@@ -0,0 +1,150 @@
+package tstruct_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Deploy struct {
+	Backend string // collides with the Backend type
+	Primary Backend
+	Route   Route // also collides
+}
+
+func TestOnConflictQualifyWithParent(t *testing.T) {
+	m := make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Deploy](m); err == nil {
+		t.Fatal("expected conflict error by default")
+	}
+	var rep tstruct.Report
+	err := tstruct.AddFuncMap[Deploy](m, tstruct.OnConflict(tstruct.QualifyWithParent), tstruct.ReportTo(&rep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range rep.Constructors {
+		got = append(got, e.String())
+	}
+	want := []string{
+		"tstruct_test.Deploy: Deploy",
+		"tstruct_test.Backend: Deploy_Backend (Backend is taken)",
+		"tstruct_test.Route: Deploy_Route (Route is taken)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got report %q, want %q", got, want)
+	}
+	// Route's Backend-typed field uses the same constructor.
+	wantDeploy := Deploy{
+		Backend: "b",
+		Primary: Backend{Addr: "p"},
+		Route:   Route{Path: "/", To: Backend{Addr: "r"}, Weight: 1},
+	}
+	m["yield"] = func(x any) error {
+		if !reflect.DeepEqual(x, wantDeploy) {
+			t.Fatalf("got %#v, want %#v", x, wantDeploy)
+		}
+		return nil
+	}
+	const tmpl = `{{ yield (Deploy (Backend "b") (Primary (Deploy_Backend (Addr "p"))) (Route (Deploy_Route "/" (To (Deploy_Backend (Addr "r"))) (Weight 1)))) }}`
+	p := template.Must(template.New("test").Funcs(m).Parse(tmpl))
+	if err := p.Execute(&strings.Builder{}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnConflictSkipNested(t *testing.T) {
+	m := make(template.FuncMap)
+	var rep tstruct.Report
+	err := tstruct.AddFuncMap[Deploy](m, tstruct.OnConflict(tstruct.SkipNested), tstruct.ReportTo(&rep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rep.Constructors[1].String(), "tstruct_test.Backend: skipped (Backend is taken)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, ok := m["Addr"]; ok {
+		t.Error("skipped type has setters")
+	}
+	// The field can still be set from template data.
+	m["yield"] = func(x any) error {
+		if got := x.(Deploy).Primary; got != (Backend{Addr: "p"}) {
+			t.Fatalf("got %#v", got)
+		}
+		return nil
+	}
+	p := template.Must(template.New("test").Funcs(m).Parse(`{{ yield (Deploy (Primary .)) }}`))
+	if err := p.Execute(&strings.Builder{}, Backend{Addr: "p"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnConflictCustom(t *testing.T) {
+	m := make(template.FuncMap)
+	var conflicts []tstruct.NameConflict
+	resolve := func(c tstruct.NameConflict) (string, error) {
+		conflicts = append(conflicts, c)
+		return c.Name + "T", nil
+	}
+	err := tstruct.AddFuncMap[Deploy](m, tstruct.OnConflict(resolve))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"BackendT", "RouteT"} {
+		if _, ok := m[name]; !ok {
+			t.Errorf("%s not registered", name)
+		}
+	}
+	if len(conflicts) != 2 {
+		t.Fatalf("got %d conflicts, want 2", len(conflicts))
+	}
+	c := conflicts[1]
+	if c.Name != "Route" || c.Type != reflect.TypeOf(Route{}) || c.Parent != reflect.TypeOf(Deploy{}) || c.ParentName != "Deploy" || c.Existing != "a field setter for tstruct_test.Deploy" {
+		t.Errorf("bad conflict: %+v", c)
+	}
+}
+
+func TestOnConflictSetter(t *testing.T) {
+	type Link struct {
+		Backend string
+	}
+	type NamedLink struct {
+		Backend string `tstruct:"name=BackendName"`
+	}
+	m := make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Backend](m); err != nil {
+		t.Fatal(err)
+	}
+	// Only constructor names are resolved.
+	err := tstruct.AddFuncMap[Link](m, tstruct.OnConflict(tstruct.QualifyWithParent))
+	if err == nil || !strings.Contains(err.Error(), "already used as the constructor for tstruct_test.Backend") {
+		t.Errorf("got %v, want setter conflict", err)
+	}
+	if err := tstruct.AddFuncMap[NamedLink](m, tstruct.OnConflict(tstruct.QualifyWithParent)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnConflictTopLevel(t *testing.T) {
+	type Addr struct{}
+	for _, r := range []tstruct.Resolver{tstruct.QualifyWithParent, tstruct.SkipNested, func(tstruct.NameConflict) (string, error) { return "", nil }} {
+		m := make(template.FuncMap)
+		if err := tstruct.AddFuncMap[Backend](m); err != nil {
+			t.Fatal(err)
+		}
+		if err := tstruct.AddFuncMap[Addr](m, tstruct.OnConflict(r)); err == nil {
+			t.Error("expected error")
+		}
+	}
+	m := make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Backend](m); err != nil {
+		t.Fatal(err)
+	}
+	bad := func(tstruct.NameConflict) (string, error) { return "Weight", nil }
+	if err := tstruct.AddFuncMap[Addr](m, tstruct.OnConflict(bad)); err == nil {
+		t.Error("expected error for resolution to a name in use")
+	}
+}
@@ -0,0 +1,43 @@
+package tstruct
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// trustedContentTypes are the names of html/template's trusted content types.
+// html/template does not escape values of these types,
+// so converting untrusted template values to them would bypass escaping.
+var trustedContentTypes = map[string]bool{
+	"CSS":      true,
+	"HTML":     true,
+	"HTMLAttr": true,
+	"JS":       true,
+	"JSStr":    true,
+	"Srcset":   true,
+	"URL":      true,
+}
+
+// isTrustedContent reports whether typ is one of html/template's trusted content types.
+// It avoids importing html/template.
+func isTrustedContent(typ reflect.Type) bool {
+	return typ.PkgPath() == "html/template" && trustedContentTypes[typ.Name()]
+}
+
+// convertFieldArg is like convertArg, but it also enforces the rules set by the field's tag.
+// In particular, unless the field is tagged trusted,
+// it refuses to convert values to html/template's trusted content types,
+// including values wrapped in nullable wrappers such as sql.Null[template.HTML].
+// Values that already have the trusted type, which must have come from Go code, are accepted.
+func (conv *converter) convertFieldArg(tag fieldTag, name string, src reflect.Value, typ reflect.Type) reflect.Value {
+	if !tag.trusted && src.Type() != typ {
+		target := typ
+		if vt, ok := nullableValueType(typ); ok {
+			target = vt
+		}
+		if src.Type() != target && isTrustedContent(target) {
+			panic(fmt.Sprintf("refusing to convert %v to %v in %s: that would bypass html/template escaping (to allow it, tag the field tstruct:\"trusted\")", src.Type(), target, name))
+		}
+	}
+	return conv.convertArg(name, src, typ)
+}
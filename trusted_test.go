@@ -0,0 +1,35 @@
+package tstruct_test
+
+import (
+	"database/sql"
+	"html/template"
+	"testing"
+)
+
+type View struct {
+	Title  string
+	Body   template.HTML
+	Links  []template.URL
+	Header template.HTML `tstruct:"trusted"`
+	Footer sql.Null[template.HTML]
+	Aside  sql.Null[template.HTML] `tstruct:"trusted"`
+}
+
+func TestTrustedContentRefused(t *testing.T) {
+	testOneWantErrStrs(t, View{}, `{{ yield (View (Body "<script>")) }}`, []string{"refusing to convert string to template.HTML in Body", `tstruct:"trusted"`})
+	testOneWantErrStrs(t, View{}, `{{ yield (View (Links "javascript:alert(1)")) }}`, []string{"refusing to convert string to template.URL in Links"})
+	testOneWantErrStrs(t, View{}, `{{ yield (View (Body .)) }}`, []string{"refusing"}, "<b>")
+	// Nullable wrappers do not hide the trusted type.
+	testOneWantErrStrs(t, View{}, `{{ yield (View (Footer "<script>x</script>")) }}`, []string{"refusing to convert string to template.HTML in Footer"})
+}
+
+func TestTrustedContentAllowed(t *testing.T) {
+	// Values that already have the trusted type came from Go code.
+	testOne(t, View{Body: "<b>hi</b>"}, `{{ yield (View (Body .)) }}`, template.HTML("<b>hi</b>"))
+	// Fields tagged trusted accept conversions.
+	testOne(t, View{Header: "<h1>"}, `{{ yield (View (Header "<h1>")) }}`)
+	testOne(t, View{Aside: sql.Null[template.HTML]{V: "<i>", Valid: true}}, `{{ yield (View (Aside "<i>")) }}`)
+	testOne(t, View{Footer: sql.Null[template.HTML]{V: "<p>", Valid: true}}, `{{ yield (View (Footer .)) }}`, template.HTML("<p>"))
+	// Ordinary strings are unaffected.
+	testOne(t, View{Title: "<t>"}, `{{ yield (View (Title "<t>")) }}`)
+}
@@ -9,222 +9,521 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 )
 
 // AddFuncMap adds constructors for T to base.
 // base must not be nil.
 // AddFuncMap will return an error if there is a conflict with any existing entries in base.
-// AddFuncMap may modify entries in base that were added by a prior call to AddFuncMap.
+// AddFuncMap may modify entries in base that were added by a prior call to AddFuncMap,
+// and may remove setters for fields that are no longer settable after re-registering a type.
 // If AddFuncMap returns a non-nil error, base will be unmodified.
-func AddFuncMap[T any](base map[string]any) error {
+// Options may adjust how T is registered.
+func AddFuncMap[T any](base map[string]any, opts ...Option) error {
+	var t T
+	return AddFuncMapType(base, reflect.TypeOf(t), opts...)
+}
+
+// AddFuncMapType is like AddFuncMap, but takes the type to register as a reflect.Type,
+// for types that are only known at run time.
+// typ must be a struct type or a pointer to one.
+// The constructor for typ returns values of type typ.
+func AddFuncMapType(base map[string]any, typ reflect.Type, opts ...Option) error {
 	if base == nil {
 		return fmt.Errorf("base FuncMap is nil")
 	}
-	var t T
-	rt := reflect.TypeOf(t)
-	origrt := rt
-	if rt.Kind() == reflect.Pointer {
-		rt = rt.Elem()
-	}
-	if rt.Kind() != reflect.Struct {
-		return fmt.Errorf("non-struct type %v", rt)
-	}
-	// Make a copy of base to modify.
-	// This is safe because all keys are strings and all values are funcs.
-	fnmap := make(map[string]any)
-	copyFuncMap(fnmap, base)
-	// Add struct and field funcs to fnmap.
-	err := addStructFuncs[T](origrt, fnmap)
+	// Recover the registry state from base, register typ, and write the result back.
+	st := loadFuncMap(base)
+	err := registerType(st, typ, opts)
 	if err != nil {
 		return err
 	}
-	// Nothing went wrong; copy our modified FuncMap back onto base.
-	copyFuncMap(base, fnmap)
+	// Nothing went wrong; copy the new entries back onto base.
+	st.writeFuncMap(base)
 	return nil
 }
 
-func copyFuncMap(dst, src map[string]any) {
-	for k, v := range src {
-		dst[k] = v
-	}
-}
-
-// addStructFuncs adds funcs to fnmap to construct structs of type rt and to populate rt's fields.
-func addStructFuncs[T any](rt reflect.Type, fnmap map[string]any) error {
-	origrt := rt
+// addStructFuncs adds funcs to st to construct structs of type rt and to populate rt's fields.
+// rt may also be a pointer to a struct type, in which case the constructor returns pointers.
+// depth is the number of levels of nesting between rt and the type passed to AddFuncMap,
+// and parent is the struct type in whose field rt was found, or nil if depth is 0.
+func addStructFuncs(rt reflect.Type, st *registryState, cfg *config, depth int, parent *structInfo) error {
+	out := rt // the constructor's result type
 	if rt.Kind() == reflect.Ptr {
 		rt = rt.Elem()
 	}
 	if rt.Name() == "" {
 		return fmt.Errorf("anonymous struct (type %v) is not supported", rt)
 	}
-	// TODO: Accept namespacing prefix(es)?
+	if depth > 0 && st.conflicted[rt] {
+		// Already processed, and its constructor's conflict recorded.
+		return nil
+	}
+	prev := st.ctorFor(rt)
+	if depth > 0 && prev != nil {
+		// Already registered, explicitly or automatically,
+		// possibly under a different name, to resolve a conflict.
+		// Reusing it must not change which of rt's fields are settable.
+		if prev.exposedOnly != cfg.exposedOnly {
+			return fmt.Errorf("%v: already registered %s the ExposedOnly option, unlike %v; use the same options for both, or tag the field noreg", rt, withOrWithout(prev.exposedOnly), parent.typ)
+		}
+		// Nor which values they accept.
+		if !prev.conv.sameFor(cfg.conv, rt) {
+			return fmt.Errorf("%v: already registered with different Implements, Func, or Enum options than %v; use the same options for both, or tag the field noreg", rt, parent.typ)
+		}
+		return nil
+	}
 
-	// Make a struct constructor for rt with the same name as the struct.
+	tname, err := cfg.typeName(rt)
+	if err != nil {
+		return err
+	}
+
+	// Make a struct constructor for rt named tname, usually the same name as the struct.
 	// It takes as arguments functions that can be applied to modify the struct.
 	// We generate functions that return such arguments below.
-	if x, ok := fnmap[rt.Name()]; ok {
-		match := registeredFuncMatches[T](x, rt)
-		if !match {
-			return fmt.Errorf("conflicting FuncMap entries for %s: %T", rt.Name(), x)
-		}
-		// We already have a constructor for this struct type.
-		// Replace it with a more precisely typed one, if possible.
-		// But if T is reflect.Value, we risk overwriting a more precisely typed function.
-		var zero T
-		if reflect.TypeOf(zero) == reflectValueType {
+	// If there's already a constructor for rt named tname, replace it:
+	// this is an explicit registration, possibly with different options.
+	hidden := false
+	conflicted := false // a conflict over rt's constructor name was recorded
+	existing := st.describe(tname)
+	err = st.checkCtorName(tname, rt)
+	if err == nil && cfg.resolver != nil && parent != nil && parent.hasField(tname) {
+		// parent's setter for the field is registered after rt's constructor.
+		// Without a Resolver, the setter would fail (or be hidden) when it is added.
+		// With one, treat the name as taken now, so that the conflict is resolved here.
+		existing = "a field setter for " + parent.typ.String()
+		err = fmt.Errorf("conflicting FuncMap entries for %s: already used as %s", tname, existing)
+	}
+	switch prev := st.ctors[tname]; {
+	case err == nil:
+		cfg.record(ReportEntry{Type: rt, Name: tname, Nested: depth > 0})
+	case cfg.resolver == nil && st.generic && (prev == nil || prev.typ == rt):
+		// Keep the constructor, but only make it available through New.
+		hidden = true
+		cfg.record(ReportEntry{Type: rt, Name: tname, Nested: depth > 0, Conflict: tname, Hidden: true})
+	case cfg.resolver == nil && st.generic && st.checkCtorName(rt.String(), rt) == nil:
+		// tname is another struct type's constructor.
+		// Keep this one, only available through New, under its qualified Go type name.
+		hidden = true
+		cfg.record(ReportEntry{Type: rt, Name: rt.String(), Nested: depth > 0, Conflict: tname, Hidden: true})
+		tname = rt.String()
+	default:
+		c := NameConflict{Name: tname, Type: rt, Existing: existing, err: err}
+		if parent != nil {
+			c.Parent, c.ParentName = parent.typ, parent.name
+		}
+		name, err := cfg.resolve(c)
+		if err != nil {
+			if err := st.conflict(tname, "the constructor for "+rt.String(), rt, err); err != nil {
+				return err
+			}
+			conflicted = true
+			break
+		}
+		if name == "" {
+			// Skip rt.
+			cfg.record(ReportEntry{Type: rt, Nested: depth > 0, Conflict: tname})
 			return nil
 		}
+		if !isTemplateIdent(name) {
+			return fmt.Errorf("%v: conflict over %s resolved with %q, which is not a valid template func name", rt, tname, name)
+		}
+		if err := st.checkCtorName(name, rt); err != nil {
+			if err := st.conflict(name, "the constructor for "+rt.String(), rt, fmt.Errorf("%v: conflict over %s resolved with %s: %v", rt, tname, name, err)); err != nil {
+				return err
+			}
+			conflicted = true
+			break
+		}
+		cfg.record(ReportEntry{Type: rt, Name: name, Nested: depth > 0, Conflict: tname})
+		tname = name
+	}
+
+	// If *rt has a TStructNew method, the constructor accepts plain (non-setter) args
+	// and passes them to TStructNew.
+	newMethod, hasNew := reflect.PtrTo(rt).MethodByName("TStructNew")
+	if hasNew {
+		if newMethod.Type.NumOut() != 0 {
+			return fmt.Errorf("(*%v).TStructNew must not return values", rt)
+		}
+		if _, ok := rt.MethodByName("TStructNew"); ok {
+			return fmt.Errorf("(%v).TStructNew must have pointer receiver", rt)
+		}
 	}
 
-	var required fieldsAreUnset
+	// Parse struct tags up front; the constructor needs to know about required and positional fields.
+	tags := make([]fieldTag, rt.NumField())
+	var required map[string]bool // template names of required fields
+	npos := 0
+	names := make(map[string]string) // template name -> Go field name
 	for i := 0; i < rt.NumField(); i++ {
 		f := rt.Field(i)
-		if !f.IsExported() || f.Tag.Get("tstruct") != "+" {
+		if !f.IsExported() {
+			tags[i] = fieldTag{ignore: true, pos: -1}
+			continue
+		}
+		tag, err := parseFieldTag(f)
+		if err != nil {
+			return err
+		}
+		if cfg.exposedOnly && !tag.expose && !tag.ignore {
+			if tag.required || tag.pos >= 0 {
+				return fmt.Errorf("%s.%s: required and positional fields must be tagged expose", tname, f.Name)
+			}
+			tag.ignore = true
+		}
+		if tag.name == "" {
+			tag.name = cfg.fieldName(f)
+			if !tag.ignore && !isTemplateIdent(tag.name) {
+				return fmt.Errorf("%s.%s: %q is not a valid template func name; use a name= tag to choose one", tname, f.Name, tag.name)
+			}
+		}
+		tags[i] = tag
+		if tag.ignore {
+			continue
+		}
+		for _, name := range append([]string{tag.name}, tag.aliases...) {
+			if prev, ok := names[name]; ok {
+				return fmt.Errorf("%s.%s: template name %s already used by %s.%s", tname, f.Name, name, tname, prev)
+			}
+			names[name] = f.Name
+		}
+		if tag.pos >= 0 {
+			npos++
+		}
+		if !tag.required {
 			continue
 		}
 		// Require that this struct field be set.
 		if required == nil {
-			required = make(fieldsAreUnset)
+			required = make(map[string]bool)
+		}
+		required[tag.name] = true
+	}
+	// Positional fields must be numbered 0 through npos-1.
+	posFields := make([]reflect.StructField, npos)
+	for i, tag := range tags {
+		if tag.pos < 0 {
+			continue
+		}
+		f := rt.Field(i)
+		if tag.pos >= npos {
+			return fmt.Errorf("%s.%s: position %d out of range, struct has %d positional fields", tname, f.Name, tag.pos, npos)
+		}
+		if prev := posFields[tag.pos]; prev.Name != "" {
+			return fmt.Errorf("%s.%s: position %d already used by %s.%s", tname, f.Name, tag.pos, tname, prev.Name)
+		}
+		posFields[tag.pos] = f
+	}
+	if hasNew && npos > 0 {
+		return fmt.Errorf("%s has both a TStructNew method and positional fields", tname)
+	}
+	// Deprecated fields forward to the field that replaces them.
+	type forward struct{ from, to int } // field indexes
+	var forwards []forward
+	for i, tag := range tags {
+		if tag.ignore || tag.deprecated == "" {
+			continue
+		}
+		f := rt.Field(i)
+		if tag.required || tag.pos >= 0 {
+			return fmt.Errorf("%s.%s: deprecated fields cannot be required or positional", tname, f.Name)
+		}
+		nf, ok := rt.FieldByName(tag.deprecated)
+		if !ok || len(nf.Index) != 1 || tags[nf.Index[0]].ignore || tags[nf.Index[0]].deprecated != "" {
+			return fmt.Errorf("%s.%s: deprecated in favor of %s, which is not a settable field", tname, f.Name, tag.deprecated)
 		}
-		required[f.Name] = true
+		forwards = append(forwards, forward{from: i, to: nf.Index[0]})
 	}
+	// posFns holds the savedApplyFns for the positional fields.
+	// It is populated below, along with the rest of the field funcs.
+	posFns := make([]savedApplyFn, npos)
 
-	fnmap[rt.Name()] = func(args ...applyFn) T {
+	construct := func(args []reflect.Value) reflect.Value {
 		v := reflect.New(rt).Elem()
+		applies, plain := splitCtorArgs(args)
+		// Plain args are applied first, so that field setters can override them.
+		switch {
+		case len(plain) == 0:
+			// Nothing to do.
+		case hasNew:
+			plain := convertNewArgs(cfg.conv, tname, newMethod.Type, plain)
+			applies = append([]applyFn{func(v reflect.Value) {
+				if didMarkAllFieldsAsSet(v) {
+					// TStructNew is responsible for the whole struct,
+					// so treat it as having set all required fields.
+					return
+				}
+				newMethod.Func.Call(append([]reflect.Value{v.Addr()}, plain...))
+			}}, applies...)
+		case npos > 0:
+			if len(plain) != npos {
+				panic(fmt.Sprintf("wrong number of positional args to %s, expected %d, got %d", tname, npos, len(plain)))
+			}
+			pos := make([]applyFn, npos)
+			for i, arg := range plain {
+				checkPositionalArg(cfg.conv, tname, posFields[i], tags[posFields[i].Index[0]], i, arg)
+				pos[i] = posFns[i](arg)
+			}
+			applies = append(pos, applies...)
+		default:
+			panic(fmt.Sprintf("%s does not accept positional arguments", tname))
+		}
 		// If there are required fields, check whether they are about to be set.
 		if required != nil {
 			// clone required
 			// TODO: when Go 1.21 is out, use maps.Clone
-			r2 := make(fieldsAreUnset, len(required))
+			r2 := make(map[string]bool, len(required))
 			for k, v := range required {
 				r2[k] = v
 			}
-			rqv := reflect.ValueOf(r2)
-			// Call apply using our special sentinel map type.
+			rqv := reflect.ValueOf(&fieldsAreUnset{typ: rt, unset: r2})
+			// Call apply using our special sentinel type.
 			// Each apply function will delete the field name it is responsible for
 			// from the map, but not do any further work.
-			for _, apply := range args {
+			for _, apply := range applies {
 				apply(rqv)
 			}
 			// Gather all unset required fields.
 			if len(r2) > 0 {
 				missing := make([]string, 0, len(r2))
 				for k := range r2 {
-					missing = append(missing, rt.Name()+"."+k)
+					missing = append(missing, tname+"."+k)
 				}
 				sort.Strings(missing)
 				panic(fmt.Sprintf("%s required but not provided", strings.Join(missing, ", ")))
 			}
 		}
 		// Now, actually set the fields.
-		for _, apply := range args {
+		for _, apply := range applies {
 			apply(v)
 		}
-		var t T
-		switch any(t).(type) {
-		case reflect.Value:
-			// We want to return a reflect.Value.
-			// v already is a reflect.Value.
-			// (We know that; help the compiler.)
-			return any(v).(T)
-		}
-		if origrt.Kind() == reflect.Pointer {
+		if out.Kind() == reflect.Pointer {
 			v = v.Addr()
 		}
-		// v holds a T. Extract it.
-		return v.Interface().(T)
+		return v
+	}
+	// The registered constructor is construct, wrapped to answer queries with info.
+	info := &structInfo{typ: rt, name: tname, nested: depth > 0, hidden: hidden, exposedOnly: cfg.exposedOnly, conv: cfg.conv}
+	info.wrap = func(info *structInfo) any {
+		return makeCtor(info, out, construct)
+	}
+	info.ctor = info.wrap(info)
+	if conflicted {
+		// The registration will fail. Keep going without rt's constructor,
+		// so that conflicts among rt's fields and nested types are recorded too.
+		st.conflicted[rt] = true
+	} else {
+		st.ctors[tname] = info
+	}
+	if prev != nil {
+		// This explicit registration replaces rt's setters,
+		// possibly with a different set of fields.
+		st.dropSetters(rt)
+	}
+
+	for i, tag := range tags {
+		if !tag.ignore {
+			info.fields = append(info.fields, fieldInfo{field: rt.Field(i), tag: tag})
+		}
 	}
 
 	// For each struct field, generate a function that modifies that struct field,
 	// named after the struct field.
 	// Make args with the same name as each of the struct fields.
+	fns := make([]savedApplyFn, rt.NumField())
 	for i := 0; i < rt.NumField(); i++ {
 		f := rt.Field(i)
 		if !f.IsExported() {
 			continue
 		}
-		if f.Tag.Get("tstruct") == "-" {
+		if tags[i].ignore {
 			// Ignore this struct field.
 			continue
 		}
-		switch f.Type.Kind() {
-		case reflect.Struct:
-			// Process this struct's fields as well!
-			// TODO: avoid panic on recursively defined structs (but really, don't do that)
-			err := addStructFuncs[reflect.Value](f.Type, fnmap)
-			if err != nil {
-				return err
-			}
-		case reflect.Slice:
-			if elem := f.Type.Elem(); elem.Kind() == reflect.Struct {
-				err := addStructFuncs[reflect.Value](elem, fnmap)
+		if tags[i].deprecated != "" {
+			// Handled below.
+			continue
+		}
+		// Process nested types as well!
+		if !tags[i].noreg && cfg.registerDepth(depth+1) {
+			for _, nested := range nestedTypes(f.Type) {
+				deps, err := addNestedFuncs(nested, st, cfg, depth+1, info)
 				if err != nil {
 					return err
 				}
-			}
-		case reflect.Map:
-			for _, elem := range []reflect.Type{f.Type.Key(), f.Type.Elem()} {
-				if elem.Kind() == reflect.Struct {
-					err := addStructFuncs[reflect.Value](elem, fnmap)
-					if err != nil {
-						return err
-					}
-				}
+				info.deps = append(info.deps, deps...)
 			}
 		}
-		name := f.Name
+		name := tags[i].name
 		// TODO: modify fn name based on field type? E.g. AppendF for a field named F of slice type?
-		fn, err := genSavedApplyFnForField(f, name)
+		fn, err := genSavedApplyFnForField(cfg.conv, f, tags[i], name)
 		if err != nil {
 			return err
 		}
-		err = setSavedApplyFn(fnmap, name, rt, fn)
-		if err != nil {
-			return err
+		fns[i] = fn
+		if pos := tags[i].pos; pos >= 0 {
+			posFns[pos] = fn
+		}
+		// Aliases share fn, which reports itself to the required field tracking under name.
+		for _, n := range append([]string{name}, tags[i].aliases...) {
+			err = st.addSetter(n, setterEntry{typ: rt, fn: fn})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// Generate setters for deprecated fields.
+	// They use the replacement field's setter, and report each use.
+	for _, fw := range forwards {
+		from, to := tags[fw.from], tags[fw.to]
+		for _, n := range append([]string{from.name}, from.aliases...) {
+			dep := &deprecation{
+				use:  DeprecatedUse{Type: rt, Name: n, Field: rt.Field(fw.to).Name, Replacement: to.name},
+				hook: cfg.onDeprecated,
+			}
+			err := st.addSetter(n, setterEntry{typ: rt, fn: fns[fw.to], dep: dep})
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func registeredFuncMatches[T any](x any, rt reflect.Type) bool {
-	// There's already a registered function with the name we want to use.
-	// If it is a tstruct constructor for the exact same type as we are
-	// trying to generate now, that's ok. Otherwise, fail.
-	_, isTypedCtor := x.(func(args ...applyFn) T)
-	if isTypedCtor {
-		// OK
-		return true
-	}
-	// Check whether x is a func(args ...applyFn) T for any T, including possibly reflect.Value.
-	// If so, call x to get a struct value whose type we can inspect.
-	xfn := reflect.ValueOf(x)
-	if xfn.Kind() != reflect.Func {
-		return false
+// A DeprecatedUse describes a template's use of a deprecated field setter.
+type DeprecatedUse struct {
+	Type        reflect.Type // the struct type
+	Name        string       // the deprecated template-visible name that was used
+	Field       string       // the Go name of the field that was set
+	Replacement string       // the template-visible name to use instead
+	Template    string       // the name of the template, as given to ForTemplate, or "" if unknown
+}
+
+// A deprecation describes a deprecated field setter.
+type deprecation struct {
+	use  DeprecatedUse       // without Template
+	hook func(DeprecatedUse) // may be nil
+}
+
+// report reports a use of the deprecated setter by the template named template.
+func (d *deprecation) report(template string) {
+	if d.hook == nil {
+		return
 	}
-	xType := xfn.Type()
-	if xType.NumIn() != 1 || xType.NumOut() != 1 || !xType.IsVariadic() {
-		return false
+	use := d.use
+	use.Template = template
+	d.hook(use)
+}
+
+// ForTemplate returns a copy of fnmap, which may contain entries added by tstruct,
+// in which deprecated field setters report uses by the template named name.
+// Go funcs cannot tell which template is calling them,
+// so to learn which templates use deprecated setters, give each template its own FuncMap:
+//
+//	t, err := template.New(name).Funcs(tstruct.ForTemplate(m, name)).Parse(text)
+//
+// Templates that share a FuncMap, such as those parsed together into one set,
+// report the same name.
+// Later calls to AddFuncMap on the returned FuncMap keep the name.
+func ForTemplate(fnmap map[string]any, name string) map[string]any {
+	st := loadFuncMap(fnmap)
+	st.template = name
+	return st.funcMap()
+}
+
+// nestedTypes returns the types within typ, a struct field type,
+// for which addNestedFuncs should be called.
+func nestedTypes(typ reflect.Type) []reflect.Type {
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Interface:
+		return []reflect.Type{typ}
+	case reflect.Slice:
+		return []reflect.Type{typ.Elem()}
+	case reflect.Map:
+		return []reflect.Type{typ.Key(), typ.Elem()}
 	}
-	in := xType.In(0)
-	if in.Kind() != reflect.Slice || in.Elem() != applyFnType {
-		return false
+	return nil
+}
+
+func withOrWithout(b bool) string {
+	if b {
+		return "with"
 	}
-	out := xfn.Call(nil)
-	s := out[0]
-	// If s is a reflect.Value (holding a reflect.Value!), use its contents instead.
-	if s.Type() == reflectValueType {
-		s = s.Interface().(reflect.Value)
+	return "without"
+}
+
+// makeCtor returns a struct constructor with result type out that calls construct,
+// answering queries with info.
+// The constructor has type func(...ctorArg) out.
+func makeCtor(info *structInfo, out reflect.Type, construct func(args []reflect.Value) reflect.Value) any {
+	typ := reflect.FuncOf([]reflect.Type{reflect.SliceOf(ctorArgType)}, []reflect.Type{out}, true)
+	fn := reflect.MakeFunc(typ, func(in []reflect.Value) []reflect.Value {
+		args := make([]reflect.Value, in[0].Len())
+		for i := range args {
+			args[i] = in[0].Index(i).Elem()
+			if !args[i].IsValid() {
+				panic(fmt.Sprintf("nil argument %d to %s", i, info.name))
+			}
+		}
+		if q, ok := isCtorQuery(args); ok {
+			q.info = info
+			return []reflect.Value{reflect.Zero(out)}
+		}
+		return []reflect.Value{construct(args)}
+	})
+	return fn.Interface()
+}
+
+// addNestedFuncs adds funcs to st for a type used within a field of parent, at the given depth.
+// For struct types, that is the struct's constructor and field funcs.
+// For interface types, it is the funcs for all registered implementations.
+// It returns the struct types whose funcs are now in st as a result.
+func addNestedFuncs(typ reflect.Type, st *registryState, cfg *config, depth int, parent *structInfo) ([]reflect.Type, error) {
+	switch typ.Kind() {
+	case reflect.Struct:
+		if isNullable(typ) || isBig(typ) {
+			// Nullable wrappers and math/big numbers are set directly from template values.
+			// Registering them would just add conflict-prone names like Valid and Int.
+			return nil, nil
+		}
+		// TODO: avoid panic on recursively defined structs (but really, don't do that)
+		err := addStructFuncs(typ, st, cfg, depth, parent)
+		if err != nil {
+			return nil, err
+		}
+		return []reflect.Type{typ}, nil
+	case reflect.Interface:
+		var deps []reflect.Type
+		for _, impl := range cfg.conv.implementations(typ) {
+			if impl.Kind() == reflect.Pointer {
+				impl = impl.Elem()
+			}
+			if impl.Kind() != reflect.Struct {
+				// Values of this type can only be provided by template data.
+				continue
+			}
+			err := addStructFuncs(impl, st, cfg, depth, parent)
+			if err != nil {
+				return nil, err
+			}
+			deps = append(deps, impl)
+		}
+		return deps, nil
 	}
-	return s.Type() == rt
+	return nil, nil
 }
 
 // fieldsAreUnset is a special sentinel type that applyFn recognizes.
-// It is a map from a field name to whether it remains unset.
-type fieldsAreUnset map[string]bool
+// applyFns receive it as a *fieldsAreUnset.
+type fieldsAreUnset struct {
+	typ   reflect.Type    // the struct type being constructed
+	unset map[string]bool // template field name -> whether it remains unset
+}
 
-var fieldsAreUnsetType = reflect.TypeOf(fieldsAreUnset(nil))
+var fieldsAreUnsetType = reflect.TypeOf((*fieldsAreUnset)(nil))
 
 // didMarkFieldAsSet checks whether this is a request to mark the field name as having been set by an apply function.
 // If it returns true, the apply function must stop processing v.
@@ -233,13 +532,175 @@ func didMarkFieldAsSet(v reflect.Value, name string) bool {
 		return false
 	}
 	// Update the map: This field is no longer unset.
-	m := v.Interface().(fieldsAreUnset)
-	delete(m, name)
+	u := v.Interface().(*fieldsAreUnset)
+	delete(u.unset, name)
+	return true
+}
+
+// applyTargetType returns the type of the struct that v, an applyFn argument, is for.
+func applyTargetType(v reflect.Value) reflect.Type {
+	if v.Type() == fieldsAreUnsetType {
+		return v.Interface().(*fieldsAreUnset).typ
+	}
+	return v.Type()
+}
+
+// fieldTag is a parsed tstruct struct tag.
+// A tag is a comma-separated list of options.
+// "-" (which must appear alone) ignores the field.
+// "+" makes the field required.
+// "pos=N" lets the Nth plain argument to the struct constructor set the field.
+// "unit=U" lets strings with units set the field; U is "bytes" (as in "64MiB") or "percent" (as in "75%").
+// "name=N" sets the template-visible name of the field's setter, instead of the Go field name.
+// "alias=N" registers an additional name for the field's setter; it may be repeated.
+// "deprecated=F" makes the field's setter set the field named F instead, reporting each use.
+// "expose" marks the field as settable when the ExposedOnly option is in use.
+// "noreg" prevents automatic registration of constructors for the field's type.
+// "trusted" allows converting template values to html/template's trusted content types, such as template.HTML.
+// Empty and unknown options are ignored.
+type fieldTag struct {
+	ignore     bool
+	required   bool
+	pos        int    // -1 if not positional
+	unit       string // "" if none
+	trusted    bool
+	noreg      bool
+	expose     bool
+	name       string   // template-visible name
+	aliases    []string // additional template-visible names
+	deprecated string   // Go name of the field that replaces this one
+}
+
+func parseFieldTag(f reflect.StructField) (fieldTag, error) {
+	tag := fieldTag{pos: -1}
+	s, ok := f.Tag.Lookup("tstruct")
+	if !ok {
+		return tag, nil
+	}
+	if s == "-" {
+		tag.ignore = true
+		return tag, nil
+	}
+	for _, opt := range strings.Split(s, ",") {
+		key, val, hasVal := strings.Cut(opt, "=")
+		switch {
+		case opt == "+":
+			tag.required = true
+		case key == "pos" && hasVal:
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return tag, fmt.Errorf("field %s: bad tstruct position %q", f.Name, val)
+			}
+			tag.pos = n
+		case opt == "trusted":
+			tag.trusted = true
+		case opt == "noreg":
+			tag.noreg = true
+		case opt == "expose":
+			tag.expose = true
+		case key == "deprecated" && hasVal:
+			tag.deprecated = val
+		case (key == "name" || key == "alias") && hasVal:
+			if !isTemplateIdent(val) {
+				return tag, fmt.Errorf("field %s: %q is not a valid template func name", f.Name, val)
+			}
+			if key == "name" {
+				tag.name = val
+			} else {
+				tag.aliases = append(tag.aliases, val)
+			}
+		case key == "unit" && hasVal:
+			err := checkUnit(f, val)
+			if err != nil {
+				return tag, err
+			}
+			tag.unit = val
+		default:
+			// Ignore unknown options, as tstruct always has,
+			// so that tags written for other versions of tstruct keep working.
+		}
+	}
+	return tag, nil
+}
+
+// checkPositionalArg panics with a helpful message if arg, the ith positional arg to the constructor named tname,
+// obviously cannot be used to set f using conv.
+// Fields with TStructSet methods or map types are left to their setters to check.
+func checkPositionalArg(conv *converter, tname string, f reflect.StructField, tag fieldTag, i int, arg reflect.Value) {
+	if _, ok := reflect.PtrTo(f.Type).MethodByName("TStructSet"); ok {
+		return
+	}
+	want := f.Type
+	switch f.Type.Kind() {
+	case reflect.Map:
+		return
+	case reflect.Slice:
+		if arg.Type().AssignableTo(want) {
+			return
+		}
+		want = want.Elem()
+	}
+	arg = applyUnit(tag.unit, tag.name, arg, want)
+	if conv.canConvertArg(arg, want) {
+		return
+	}
+	panic(fmt.Sprintf("positional arg %d to %s (field %s) has type %v, expected %v", i, tname, tag.name, arg.Type(), want))
+}
+
+// convertNewArgs converts plain, the plain args to the constructor named tname,
+// to the parameter types of its TStructNew method, whose type (including the receiver) is mt.
+func convertNewArgs(conv *converter, tname string, mt reflect.Type, plain []reflect.Value) []reflect.Value {
+	nin := mt.NumIn() - 1 // excluding the receiver
+	switch {
+	case mt.IsVariadic() && len(plain) < nin-1:
+		panic(fmt.Sprintf("wrong number of args to %s, expected at least %d, got %d", tname, nin-1, len(plain)))
+	case !mt.IsVariadic() && len(plain) != nin:
+		panic(fmt.Sprintf("wrong number of args to %s, expected %d, got %d", tname, nin, len(plain)))
+	}
+	args := make([]reflect.Value, len(plain))
+	for i, arg := range plain {
+		var typ reflect.Type
+		if mt.IsVariadic() && i >= nin-1 {
+			typ = mt.In(nin).Elem()
+		} else {
+			typ = mt.In(i + 1)
+		}
+		args[i] = conv.convertArg(fmt.Sprintf("arg %d to %s", i, tname), devirt(arg), typ)
+	}
+	return args
+}
+
+// didMarkAllFieldsAsSet is like didMarkFieldAsSet, but marks every field as set.
+func didMarkAllFieldsAsSet(v reflect.Value) bool {
+	if v.Type() != fieldsAreUnsetType {
+		return false
+	}
+	u := v.Interface().(*fieldsAreUnset)
+	for k := range u.unset {
+		delete(u.unset, k)
+	}
 	return true
 }
 
-// genSavedApplyFnForField generates a savedApplyFn for f, to be given name name.
-func genSavedApplyFnForField(f reflect.StructField, name string) (savedApplyFn, error) {
+// splitCtorArgs splits the args to a struct constructor into
+// field setters (applyFns) and plain, devirtualized values.
+func splitCtorArgs(args []reflect.Value) (applies []applyFn, plain []reflect.Value) {
+	for _, arg := range devirtAll(args) {
+		if arg.Type() == applyFnType {
+			applies = append(applies, arg.Interface().(applyFn))
+			continue
+		}
+		plain = append(plain, arg)
+	}
+	return applies, plain
+}
+
+// genSavedApplyFnForField generates a savedApplyFn for f, which has tag tag, to be given name name.
+// It uses conv to convert template values for f.
+func genSavedApplyFnForField(conv *converter, f reflect.StructField, tag fieldTag, name string) (savedApplyFn, error) {
+	if err := checkNullable(f.Name, f.Type); err != nil {
+		return nil, err
+	}
 	method, ok := reflect.PtrTo(f.Type).MethodByName("TStructSet")
 	if ok {
 		if method.Type.NumOut() != 0 {
@@ -257,7 +718,7 @@ func genSavedApplyFnForField(f reflect.StructField, name string) (savedApplyFn,
 				dvArgs := devirtAll(args)
 				args = append([]reflect.Value{x}, dvArgs...)
 				method.Func.Call(args)
-				convertAndSet(v.FieldByIndex(f.Index), x.Elem())
+				conv.convertAndSet(name, v.FieldByIndex(f.Index), x.Elem())
 			}
 		}, nil
 	}
@@ -273,11 +734,11 @@ func genSavedApplyFnForField(f reflect.StructField, name string) (savedApplyFn,
 				if f.IsZero() {
 					f.Set(reflect.MakeMap(f.Type()))
 				}
+				ftyp := f.Type()
 				if len(args) == 1 {
 					// If it is a map arg with appropriate types, copy the elems over.
 					arg := devirt(args[0])
 					typ := arg.Type()
-					ftyp := f.Type()
 					if typ.Kind() == reflect.Map && typ.Key().AssignableTo(ftyp.Key()) && typ.Elem().AssignableTo(ftyp.Elem()) {
 						iter := arg.MapRange()
 						for iter.Next() {
@@ -291,9 +752,9 @@ func genSavedApplyFnForField(f reflect.StructField, name string) (savedApplyFn,
 					panic(fmt.Sprintf("odd number of args to %v, expected (key, elem) pairs, got %d args", name, len(args)))
 				}
 				for i := 0; i < len(args); i += 2 {
-					k := args[i]
-					e := args[i+1]
-					f.SetMapIndex(devirt(k), devirt(e))
+					k := conv.convertFieldArg(tag, name, devirt(args[i]), ftyp.Key())
+					e := conv.convertFieldArg(tag, name, applyUnit(tag.unit, name, devirt(args[i+1]), ftyp.Elem()), ftyp.Elem())
+					f.SetMapIndex(k, e)
 				}
 			}
 		}, nil
@@ -308,7 +769,8 @@ func genSavedApplyFnForField(f reflect.StructField, name string) (savedApplyFn,
 					if arg.Type().AssignableTo(f.Type()) {
 						f.Set(reflect.AppendSlice(f, arg))
 					} else {
-						f.Set(reflect.Append(f, arg))
+						arg = applyUnit(tag.unit, name, arg, f.Type().Elem())
+						f.Set(reflect.Append(f, conv.convertFieldArg(tag, name, arg, f.Type().Elem())))
 					}
 				}
 			}
@@ -326,7 +788,7 @@ func genSavedApplyFnForField(f reflect.StructField, name string) (savedApplyFn,
 			switch len(args) {
 			case 0:
 				// special case for ergonomics: treat (X) as (X true) when destination has bool type
-				if out.Type().Kind() == reflect.Bool {
+				if isBool(out.Type()) {
 					x = reflect.ValueOf(true)
 				}
 			case 1:
@@ -335,57 +797,32 @@ func genSavedApplyFnForField(f reflect.StructField, name string) (savedApplyFn,
 			if !x.IsValid() {
 				panic("wrong number of args to " + name + ", expected 1")
 			}
-			convertAndSet(out, devirt(x))
+			out.Set(conv.convertFieldArg(tag, name, applyUnit(tag.unit, name, devirt(x), out.Type()), out.Type()))
 		}
 	}, nil
 }
 
-func setSavedApplyFn(fnmap map[string]any, name string, typ reflect.Type, fn savedApplyFn) error {
-	existing, ok := fnmap[name]
-	if !ok {
-		// We are the first ones to use this function name.
-		fnmap[name] = fn
-		return nil
-	}
-	dispatch, ok := existing.(savedApplyFn)
-	if !ok {
-		// Someone has used this name for something other than a savedApplyFn.
-		// Refuse to overwrite it.
-		return fmt.Errorf("conflicting FuncMap entries for %s", name)
-	}
-	// We previously used this name for a savedApplyFn.
-	// This happens when two structs share the same field name.
-	// In that case, replace the function with a new function
-	// that checks whether we're being applied to the right struct type,
-	// and if not, dispatches to the previous savedApplyFn.
-	fnmap[name] = func(args ...reflect.Value) applyFn {
-		return func(dst reflect.Value) {
-			if didMarkFieldAsSet(dst, name) {
-				return
-			}
-			if dst.Type() == typ {
-				// We can handle this type! Do it.
-				fn(args...)(dst)
-				return
-			}
-			// Dispatch to a previous function, in the hopes
-			// that it can handle this unknown type.
-			dispatch(args...)(dst)
-		}
-	}
-	return nil
-}
-
 // A savedApplyFn accepts arguments from a template and saves them to be applied later.
 type savedApplyFn = func(args ...reflect.Value) applyFn
 
+// A setterFunc is a field setter in a FuncMap.
+// Only tstruct creates values of this type,
+// so field setters can be recognized without calling them.
+type setterFunc func(args ...reflect.Value) applyFn
+
+// A ctorArg is an argument to a struct constructor in a FuncMap.
+// Struct constructors have type func(...ctorArg) T.
+// Only tstruct creates funcs with this parameter type,
+// so struct constructors can be recognized without calling them.
+type ctorArg any
+
 // An applyFn applies previously saved arguments to v.
 type applyFn = func(v reflect.Value)
 
 // TODO: use reflect.TypeFor once Go 1.22 comes out
 var (
-	applyFnType      = reflect.TypeOf(applyFn(nil))
-	reflectValueType = reflect.TypeOf(reflect.Value{})
+	applyFnType = reflect.TypeOf(applyFn(nil))
+	ctorArgType = reflect.TypeOf((*ctorArg)(nil)).Elem()
 )
 
 // devirt makes x have a concrete type.
@@ -405,6 +842,147 @@ func devirtAll(s []reflect.Value) []reflect.Value {
 	return c
 }
 
-func convertAndSet(dst, src reflect.Value) {
-	dst.Set(src.Convert(dst.Type()))
+// A converter converts template values for storage in struct fields.
+// It holds the values configured by a registration's options,
+// such as the implementations of interface types, named funcs, and enum names.
+// A converter is not modified once the options have been applied.
+type converter struct {
+	impls map[reflect.Type][]reflect.Type           // interface type -> implementations, in registration order
+	funcs map[reflect.Type]map[string]reflect.Value // func type -> name -> func
+	enums map[reflect.Type]map[string]reflect.Value // enum type -> name -> value
+}
+
+// sameFor reports whether conv and other convert template values the same way
+// for the fields of the struct type typ, including those of the struct types they lead to.
+// Funcs registered with the Func option are compared by code pointer.
+func (conv *converter) sameFor(other *converter, typ reflect.Type) bool {
+	seen := make(map[reflect.Type]bool)
+	conv.reachable(typ, seen, other)
+	for t := range seen {
+		switch t.Kind() {
+		case reflect.Interface:
+			a, b := conv.impls[t], other.impls[t]
+			if len(a) != len(b) {
+				return false
+			}
+			for i := range a {
+				if a[i] != b[i] {
+					return false
+				}
+			}
+		case reflect.Func:
+			for _, c := range []*converter{conv, other} {
+				for ft := range c.funcs {
+					if ft.ConvertibleTo(t) && !sameValues(conv.funcs[ft], other.funcs[ft]) {
+						return false
+					}
+				}
+			}
+		default:
+			if !sameValues(conv.enums[t], other.enums[t]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reachable adds to seen typ and the types it leads to:
+// element types, the types of struct fields,
+// and the implementations of interfaces registered with conv or others.
+func (conv *converter) reachable(typ reflect.Type, seen map[reflect.Type]bool, others ...*converter) {
+	if seen[typ] {
+		return
+	}
+	seen[typ] = true
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		conv.reachable(typ.Elem(), seen, others...)
+	case reflect.Map:
+		conv.reachable(typ.Key(), seen, others...)
+		conv.reachable(typ.Elem(), seen, others...)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if tag, err := parseFieldTag(f); f.IsExported() && (err != nil || !tag.ignore) {
+				conv.reachable(f.Type, seen, others...)
+			}
+		}
+	case reflect.Interface:
+		for _, c := range append([]*converter{conv}, others...) {
+			for _, impl := range c.impls[typ] {
+				conv.reachable(impl, seen, others...)
+			}
+		}
+	}
+}
+
+// sameValues reports whether a and b, enum values or funcs by name, are the same.
+func sameValues(a, b map[string]reflect.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, x := range a {
+		y, ok := b[name]
+		if !ok || x.Type() != y.Type() {
+			return false
+		}
+		if x.Kind() == reflect.Func {
+			if x.Pointer() != y.Pointer() {
+				return false
+			}
+		} else if x.Interface() != y.Interface() {
+			return false
+		}
+	}
+	return true
+}
+
+// convertAndSet converts src to dst's type and stores it in dst,
+// which is (part of) the value of the field named name.
+func (conv *converter) convertAndSet(name string, dst, src reflect.Value) {
+	dst.Set(conv.convertArg(name, src, dst.Type()))
+}
+
+// convertArg converts src to typ, for use as (part of) the value of the field named name.
+// It panics if src cannot be converted to typ; canConvertArg reports whether that will happen,
+// ignoring failed lookups of named values.
+func (conv *converter) convertArg(name string, src reflect.Value, typ reflect.Type) reflect.Value {
+	switch {
+	case src.Type() == typ:
+		return src
+	case typ.Kind() == reflect.Interface:
+		return conv.convertToInterface(name, src, typ)
+	case isBig(typ):
+		return convertToBig(name, src, typ)
+	case isNullable(typ):
+		return conv.convertToNullable(name, src, typ)
+	case src.Kind() == reflect.String && conv.isEnum(typ):
+		return conv.lookupEnum(name, src.String(), typ)
+	case src.Kind() == reflect.String && typ.Kind() == reflect.Func:
+		return conv.lookupFunc(name, src.String(), typ)
+	case src.Type().ConvertibleTo(typ):
+		return src.Convert(typ)
+	}
+	panic(fmt.Sprintf("cannot use %v as %v in %s", src.Type(), typ, name))
+}
+
+// canConvertArg reports whether convertArg can convert src to typ.
+func (conv *converter) canConvertArg(src reflect.Value, typ reflect.Type) bool {
+	switch {
+	case src.Type() == typ:
+		return true
+	case typ.Kind() == reflect.Interface:
+		return src.Type().AssignableTo(typ) || reflect.PtrTo(src.Type()).Implements(typ)
+	case isBig(typ):
+		return canConvertToBig(src.Type())
+	case isNullable(typ):
+		vt, _ := nullableValueType(typ)
+		return conv.canConvertArg(src, vt)
+	case src.Kind() == reflect.String && conv.isEnum(typ):
+		return true
+	case src.Kind() == reflect.String && typ.Kind() == reflect.Func:
+		return true
+	}
+	return src.Type().ConvertibleTo(typ)
 }
@@ -3,6 +3,7 @@ package tstruct_test
 import (
 	"io"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"text/template"
@@ -157,12 +158,6 @@ type WrapS struct {
 	Inner S
 }
 
-type (
-	sFn  = func(...func(reflect.Value)) S
-	wsFn = func(...func(reflect.Value)) WrapS
-	rvFn = func(...func(reflect.Value)) reflect.Value
-)
-
 func TestFieldReuseOuterInner(t *testing.T) {
 	m := make(template.FuncMap)
 	err := tstruct.AddFuncMap[WrapS](m)
@@ -173,8 +168,8 @@ func TestFieldReuseOuterInner(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	wantType[sFn](t, m["S"])
-	wantType[wsFn](t, m["WrapS"])
+	wantCtor[S](t, m["S"])
+	wantCtor[WrapS](t, m["WrapS"])
 }
 
 func TestFieldReuseInnerOuter(t *testing.T) {
@@ -187,15 +182,17 @@ func TestFieldReuseInnerOuter(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	wantType[sFn](t, m["S"])
-	wantType[wsFn](t, m["WrapS"])
+	wantCtor[S](t, m["S"])
+	wantCtor[WrapS](t, m["WrapS"])
 }
 
-func wantType[T any](t *testing.T, got any) {
+// wantCtor checks that got is a struct constructor returning T.
+func wantCtor[T any](t *testing.T, got any) {
 	t.Helper()
-	z, ok := got.(T)
-	if !ok {
-		t.Fatalf("expected %T, got %T", z, got)
+	want := reflect.TypeOf((*T)(nil)).Elem()
+	typ := reflect.TypeOf(got)
+	if typ == nil || typ.Kind() != reflect.Func || typ.NumOut() != 1 || typ.Out(0) != want {
+		t.Fatalf("expected a constructor returning %v, got %T", want, got)
 	}
 }
 
@@ -280,14 +277,24 @@ func TestInterfaceField(t *testing.T) {
 }
 
 func testOne[T any](t *testing.T, want T, tmpl string, dots ...any) {
-	err := testRunOne[T](t, want, tmpl, dots...)
+	testOneWith(t, nil, want, tmpl, dots...)
+}
+
+func testOneWantErrStrs[T any](t *testing.T, want T, tmpl string, substrs []string, dots ...any) {
+	testOneWithWantErrStrs(t, nil, want, tmpl, substrs, dots...)
+}
+
+// testOneWith is like testOne, but registers T with opts.
+func testOneWith[T any](t *testing.T, opts []tstruct.Option, want T, tmpl string, dots ...any) {
+	err := testRunOne[T](t, opts, want, tmpl, dots...)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func testOneWantErrStrs[T any](t *testing.T, want T, tmpl string, substrs []string, dots ...any) {
-	err := testRunOne[T](t, want, tmpl, dots...)
+// testOneWithWantErrStrs is like testOneWantErrStrs, but registers T with opts.
+func testOneWithWantErrStrs[T any](t *testing.T, opts []tstruct.Option, want T, tmpl string, substrs []string, dots ...any) {
+	err := testRunOne[T](t, opts, want, tmpl, dots...)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -298,10 +305,10 @@ func testOneWantErrStrs[T any](t *testing.T, want T, tmpl string, substrs []stri
 	}
 }
 
-func testRunOne[T any](t *testing.T, want T, tmpl string, dots ...any) error {
+func testRunOne[T any](t *testing.T, opts []tstruct.Option, want T, tmpl string, dots ...any) error {
 	t.Helper()
 	m := make(template.FuncMap)
-	err := tstruct.AddFuncMap[T](m)
+	err := tstruct.AddFuncMap[T](m, opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -603,3 +610,518 @@ func TestPtr(t *testing.T) {
 type Ptr struct {
 	P *T
 }
+
+type Point struct {
+	X, Y int
+}
+
+func (p *Point) TStructNew(x, y int) {
+	p.X = x
+	p.Y = y
+}
+
+type Segment struct {
+	A, B Point `tstruct:"+"`
+}
+
+func TestTStructNew(t *testing.T) {
+	testOne(t, Point{X: 1, Y: 2}, `{{ yield (Point 1 2) }}`)
+	// Field setters are applied after TStructNew.
+	testOne(t, Point{X: 1, Y: 3}, `{{ yield (Point 1 2 (Y 3)) }}`)
+	testOne(t, Point{X: 1, Y: 3}, `{{ yield (Point (Y 3) 1 2) }}`)
+	// Without plain args, TStructNew is not called.
+	testOne(t, Point{Y: 3}, `{{ yield (Point (Y 3)) }}`)
+	// Nested constructors accept plain args too.
+	testOne(t, Segment{A: Point{X: 1, Y: 2}, B: Point{X: 3, Y: 4}}, `{{ yield (Segment (A (Point 1 2)) (B (Point 3 4))) }}`)
+	// Wrong arity is an error.
+	testOneWantErrStrs(t, Point{}, `{{ yield (Point 1) }}`, []string{"wrong number of args to Point, expected 2, got 1"})
+	testOneWantErrStrs(t, Point{}, `{{ yield (Point 1 2 3) }}`, []string{"wrong number of args to Point, expected 2, got 3"})
+	testOneWantErrStrs(t, Point{}, `{{ yield (Point 1 "x") }}`, []string{"cannot use string as int in arg 1 to Point"})
+}
+
+type FPoint struct {
+	X, Y float64
+}
+
+func (p *FPoint) TStructNew(x, y float64) {
+	p.X, p.Y = x, y
+}
+
+type Polyline struct {
+	Name string
+	Xs   []float64
+}
+
+func (p *Polyline) TStructNew(name string, xs ...float64) {
+	p.Name, p.Xs = name, xs
+}
+
+func TestTStructNewConvertsArgs(t *testing.T) {
+	testOne(t, FPoint{X: 1, Y: 2.5}, `{{ yield (FPoint 1 2.5) }}`)
+	testOne(t, Polyline{Name: "p", Xs: []float64{1, 2}}, `{{ yield (Polyline "p" 1 2) }}`)
+	testOne(t, Polyline{Name: "p", Xs: []float64{}}, `{{ yield (Polyline "p") }}`)
+	testOneWantErrStrs(t, Polyline{}, `{{ yield (Polyline "p" 1 "x") }}`, []string{"cannot use string as float64 in arg 2 to Polyline"})
+	testOneWantErrStrs(t, FPoint{}, `{{ yield (FPoint 1) }}`, []string{"wrong number of args to FPoint, expected 2, got 1"})
+}
+
+func TestTStructNewRequired(t *testing.T) {
+	type Req struct {
+		X int `tstruct:"+"`
+	}
+	testOneWantErrStrs(t, Req{}, `{{ yield (Req 1) }}`, []string{"does not accept positional arguments"})
+}
+
+type BadNew struct {
+	X int
+}
+
+func (BadNew) TStructNew(x int) {}
+
+func TestTStructNewValueReceiver(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[BadNew](m)
+	if err == nil {
+		t.Fatalf("expected error, got %#v", m)
+	}
+}
+
+type Range struct {
+	Lo   int `tstruct:"pos=0"`
+	Hi   int `tstruct:"pos=1,+"`
+	Tags []string
+	Name string
+	x    int
+}
+
+func TestPositional(t *testing.T) {
+	testOne(t, Range{Lo: 1, Hi: 2}, `{{ yield (Range 1 2) }}`)
+	testOne(t, Range{Lo: 1, Hi: 2, Name: "r"}, `{{ yield (Range (Name "r") 1 2) }}`)
+	// Setters override positional args.
+	testOne(t, Range{Lo: 1, Hi: 3}, `{{ yield (Range 1 2 (Hi 3)) }}`)
+	testOne(t, Range{Lo: 1, Hi: 3}, `{{ yield (Range (Lo 1) (Hi 3)) }}`)
+	// Positional args count towards required fields.
+	testOneWantErrStrs(t, Range{}, `{{ yield (Range (Lo 1)) }}`, []string{"Range.Hi", "required"})
+	// Arity and type errors.
+	testOneWantErrStrs(t, Range{}, `{{ yield (Range 1) }}`, []string{"wrong number of positional args", "expected 2, got 1"})
+	testOneWantErrStrs(t, Range{}, `{{ yield (Range 1 2 3) }}`, []string{"wrong number of positional args", "expected 2, got 3"})
+	testOneWantErrStrs(t, Range{}, `{{ yield (Range 1 "x") }}`, []string{"positional arg 1", "field Hi", "string"})
+}
+
+func TestPositionalSlice(t *testing.T) {
+	type Tagged struct {
+		Tags []string `tstruct:"pos=0"`
+	}
+	testOne(t, Tagged{Tags: []string{"a"}}, `{{ yield (Tagged "a") }}`)
+	testOne(t, Tagged{Tags: []string{"a", "b"}}, `{{ yield (Tagged .) }}`, []string{"a", "b"})
+	testOneWantErrStrs(t, Tagged{}, `{{ yield (Tagged 1.5) }}`, []string{"positional arg 0", "expected string"})
+}
+
+type NewAndPos struct {
+	A int `tstruct:"pos=0"`
+}
+
+func (p *NewAndPos) TStructNew(a int) { p.A = a }
+
+func TestUnknownTagOptions(t *testing.T) {
+	type Unknown struct {
+		A int `tstruct:"bogus"`
+		B int `tstruct:""`
+		C int `tstruct:"+,bogus=1"`
+	}
+	testOne(t, Unknown{A: 1, B: 2, C: 3}, `{{ yield (Unknown (A 1) (B 2) (C 3)) }}`)
+	testOneWantErrStrs(t, Unknown{}, `{{ yield (Unknown (A 1)) }}`, []string{"Unknown.C required"})
+}
+
+func TestPositionalTagErrors(t *testing.T) {
+	type Gap struct {
+		A int `tstruct:"pos=0"`
+		B int `tstruct:"pos=2"`
+	}
+	type Dup struct {
+		A int `tstruct:"pos=0"`
+		B int `tstruct:"pos=0"`
+	}
+	type Bad struct {
+		A int `tstruct:"pos=x"`
+	}
+	for _, add := range []func(map[string]any, ...tstruct.Option) error{
+		tstruct.AddFuncMap[Gap],
+		tstruct.AddFuncMap[Dup],
+		tstruct.AddFuncMap[Bad],
+		tstruct.AddFuncMap[NewAndPos],
+	} {
+		m := make(template.FuncMap)
+		err := add(m)
+		if err == nil {
+			t.Errorf("expected error, got %#v", m)
+		}
+	}
+}
+
+type Vendor struct {
+	Config VendorConfig
+}
+
+type VendorConfig struct {
+	Options VendorOptions
+}
+
+type VendorOptions struct {
+	Verbose bool
+}
+
+func TestNoReg(t *testing.T) {
+	type App struct {
+		Name string
+		Vend Vendor `tstruct:"noreg"`
+	}
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[App](m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Vendor", "VendorConfig", "VendorOptions", "Config", "Options", "Verbose"} {
+		if _, ok := m[name]; ok {
+			t.Errorf("unexpected FuncMap entry %s", name)
+		}
+	}
+	// The field can still be set from template data.
+	v := Vendor{Config: VendorConfig{Options: VendorOptions{Verbose: true}}}
+	testOne(t, App{Vend: v}, `{{ yield (App (Vend .)) }}`, v)
+}
+
+func TestMaxDepth(t *testing.T) {
+	type App struct {
+		Vend Vendor
+	}
+	for depth, want := range [][]string{
+		0: {"App", "Vend"},
+		1: {"App", "Vend", "Vendor", "Config"},
+		2: {"App", "Vend", "Vendor", "Config", "VendorConfig", "Options"},
+		3: {"App", "Vend", "Vendor", "Config", "VendorConfig", "Options", "VendorOptions", "Verbose"},
+	} {
+		m := make(template.FuncMap)
+		err := tstruct.AddFuncMap[App](m, tstruct.MaxDepth(depth))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for name := range m {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("MaxDepth(%d): got %v, want %v", depth, got, want)
+		}
+	}
+}
+
+type Account struct {
+	Name    string `tstruct:"expose"`
+	Owner   Person `tstruct:"expose"`
+	Balance int
+	Admin   bool
+}
+
+type Person struct {
+	Nick  string `tstruct:"expose"`
+	Email string
+}
+
+func TestExposedOnly(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Account](m, tstruct.ExposedOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for name := range m {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	want := []string{"Account", "Name", "Nick", "Owner", "Person"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Without ExposedOnly, the expose tag is harmless.
+	testOne(t, Account{Name: "a", Balance: 1, Owner: Person{Email: "e"}}, `{{ yield (Account (Name "a") (Balance 1) (Owner (Person (Email "e")))) }}`)
+}
+
+func TestExposedOnlyReuse(t *testing.T) {
+	type Team struct {
+		Lead Person
+	}
+	// Person is already registered, with all its fields settable.
+	m := make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Team](m); err != nil {
+		t.Fatal(err)
+	}
+	err := tstruct.AddFuncMap[Account](m, tstruct.ExposedOnly())
+	if err == nil || !strings.Contains(err.Error(), "already registered without the ExposedOnly option") {
+		t.Fatalf("got %v, want ExposedOnly mismatch error", err)
+	}
+	// The same goes the other way around.
+	m = make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Account](m, tstruct.ExposedOnly()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Team](m); err == nil {
+		t.Fatal("expected ExposedOnly mismatch error")
+	}
+	// Registering Person explicitly replaces its setters.
+	m = make(template.FuncMap)
+	if err := tstruct.AddFuncMap[Team](m); err != nil {
+		t.Fatal(err)
+	}
+	if err := tstruct.AddFuncMap[Person](m, tstruct.ExposedOnly()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["Email"]; ok {
+		t.Error("Email is still settable")
+	}
+}
+
+func TestExposedOnlyRequired(t *testing.T) {
+	type Secret struct {
+		Key string `tstruct:"+"`
+	}
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Secret](m, tstruct.ExposedOnly())
+	if err == nil {
+		t.Fatalf("expected error, got %#v", m)
+	}
+}
+
+func TestFieldNameTags(t *testing.T) {
+	type Server struct {
+		ListenPort int    `tstruct:"name=port,alias=Port,alias=ListenPort,+"`
+		Host       string `tstruct:"name=host"`
+	}
+	want := Server{ListenPort: 80, Host: "h"}
+	testOne(t, want, `{{ yield (Server (port 80) (host "h")) }}`)
+	testOne(t, want, `{{ yield (Server (Port 80) (host "h")) }}`)
+	testOne(t, want, `{{ yield (Server (ListenPort 80) (host "h")) }}`)
+	// Errors use the template-visible name.
+	testOneWantErrStrs(t, want, `{{ yield (Server (host "h")) }}`, []string{"Server.port required"})
+}
+
+func TestFieldAliasDispatch(t *testing.T) {
+	// Two types share alias names, with different primary names.
+	type A struct {
+		X int `tstruct:"alias=V,+"`
+	}
+	type B struct {
+		Y string `tstruct:"alias=V,+"`
+	}
+	m := make(template.FuncMap)
+	for _, err := range []error{tstruct.AddFuncMap[A](m), tstruct.AddFuncMap[B](m)} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []any
+	m["yield"] = func(x any) string {
+		got = append(got, x)
+		return ""
+	}
+	p, err := template.New("test").Funcs(m).Parse(`{{ yield (A (V 1)) }}{{ yield (B (V "b")) }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Execute(io.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{A{X: 1}, B{Y: "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFieldNameTagErrors(t *testing.T) {
+	type Dup struct {
+		A int `tstruct:"name=x"`
+		B int `tstruct:"alias=x"`
+	}
+	type Bad struct {
+		A int `tstruct:"name=not-valid"`
+	}
+	for _, add := range []func(map[string]any, ...tstruct.Option) error{
+		tstruct.AddFuncMap[Dup],
+		tstruct.AddFuncMap[Bad],
+	} {
+		m := make(template.FuncMap)
+		err := add(m)
+		if err == nil {
+			t.Errorf("expected error, got %#v", m)
+		}
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	type Server struct {
+		Port       int `tstruct:"deprecated=ListenPort,alias=P"`
+		ListenPort int `tstruct:"+"`
+		Host       string
+	}
+	var uses []tstruct.DeprecatedUse
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Server](m, tstruct.OnDeprecated(func(u tstruct.DeprecatedUse) {
+		uses = append(uses, u)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Server
+	m["yield"] = func(s Server) string {
+		got = append(got, s)
+		return ""
+	}
+	p, err := template.New("test").Funcs(m).Parse(`{{ yield (Server (Port 80)) }}{{ yield (Server (ListenPort 81)) }}{{ yield (Server (P 82)) }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Execute(io.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The old setter sets the new field, and counts towards its requiredness.
+	want := []Server{{ListenPort: 80}, {ListenPort: 81}, {ListenPort: 82}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	wantUses := []tstruct.DeprecatedUse{
+		{Type: reflect.TypeOf(Server{}), Name: "Port", Field: "ListenPort", Replacement: "ListenPort"},
+		{Type: reflect.TypeOf(Server{}), Name: "P", Field: "ListenPort", Replacement: "ListenPort"},
+	}
+	if !reflect.DeepEqual(uses, wantUses) {
+		t.Errorf("got uses %v, want %v", uses, wantUses)
+	}
+	// Without a hook, deprecated setters just work.
+	testOne(t, Server{ListenPort: 80}, `{{ yield (Server (Port 80)) }}`)
+}
+
+func TestDeprecatedForTemplate(t *testing.T) {
+	type Server struct {
+		Port       int `tstruct:"deprecated=ListenPort"`
+		ListenPort int
+	}
+	type Client struct {
+		Addr string
+	}
+	var uses []string
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[Server](m, tstruct.GenericFuncs(), tstruct.OnDeprecated(func(u tstruct.DeprecatedUse) {
+		uses = append(uses, u.Template+":"+u.Name)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m["yield"] = func(Server) string { return "" }
+	a := tstruct.ForTemplate(m, "a.tmpl")
+	// Later registrations keep the name.
+	err = tstruct.AddFuncMap[Client](a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, fm := range map[string]template.FuncMap{"a.tmpl": a, "b.tmpl": tstruct.ForTemplate(m, "b.tmpl"), "shared": m} {
+		p, err := template.New(name).Funcs(fm).Parse(`{{ yield (Server (Port 80)) }}{{ yield (New "Server" (Set "Port" 81)) }}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p.Execute(io.Discard, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(uses)
+	want := []string{":Port", ":Port", "a.tmpl:Port", "a.tmpl:Port", "b.tmpl:Port", "b.tmpl:Port"}
+	if !reflect.DeepEqual(uses, want) {
+		t.Errorf("got uses %q, want %q", uses, want)
+	}
+}
+
+func TestDeprecatedErrors(t *testing.T) {
+	type Missing struct {
+		Old int `tstruct:"deprecated=New"`
+	}
+	type Required struct {
+		Old int `tstruct:"deprecated=New,+"`
+		New int
+	}
+	type Chained struct {
+		Older int `tstruct:"deprecated=Old"`
+		Old   int `tstruct:"deprecated=New"`
+		New   int
+	}
+	for _, add := range []func(map[string]any, ...tstruct.Option) error{
+		tstruct.AddFuncMap[Missing],
+		tstruct.AddFuncMap[Required],
+		tstruct.AddFuncMap[Chained],
+	} {
+		m := make(template.FuncMap)
+		err := add(m)
+		if err == nil {
+			t.Errorf("expected error, got %#v", m)
+		}
+	}
+}
+
+func TestAddFuncMapType(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMapType(m, reflect.TypeOf(WrapS{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCtor[WrapS](t, m["WrapS"])
+	wantCtor[S](t, m["S"])
+	// An explicit registration replaces the nested one.
+	err = tstruct.AddFuncMapType(m, reflect.TypeOf(&S{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCtor[*S](t, m["S"])
+
+	want := &S{URL: "u", List: []int{1}}
+	m["yield"] = func(x any) error {
+		if !reflect.DeepEqual(x, want) {
+			t.Fatalf("got %#v, want %#v", x, want)
+		}
+		return nil
+	}
+	p := template.Must(template.New("test").Funcs(m).Parse(`{{ yield (S (URL "u") (List 1)) }}`))
+	if err := p.Execute(io.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tstruct.AddFuncMapType(m, reflect.TypeOf(0)); err == nil {
+		t.Error("expected error for non-struct type")
+	}
+	if err := tstruct.AddFuncMapType(m, nil); err == nil {
+		t.Error("expected error for nil type")
+	}
+}
+
+func TestNestedConstructorsAreTyped(t *testing.T) {
+	m := make(template.FuncMap)
+	err := tstruct.AddFuncMap[WrapS](m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCtor[S](t, m["S"])
+	m["url"] = func(s S) string { return s.URL }
+	p := template.Must(template.New("test").Funcs(m).Parse(`{{ printf "%T" (S) }} {{ url (S (URL "u")) }}`))
+	var buf strings.Builder
+	if err := p.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "tstruct_test.S u"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestConstructorNilArg(t *testing.T) {
+	testOneWantErrStrs(t, S{}, `{{ yield (S nil) }}`, []string{"nil argument 0 to S"})
+	testOneWantErrStrs(t, S{}, `{{ yield (S (URL "u") .) }}`, []string{"nil argument 1 to S"}, nil)
+}
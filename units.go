@@ -0,0 +1,161 @@
+package tstruct
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// A unit describes how to parse strings for fields tagged with unit=name.
+type unit struct {
+	// parse parses s, returning an int64 or float64.
+	parse func(s string) (any, bool)
+	// accepted describes the accepted strings, for error messages.
+	accepted string
+	// kinds are the acceptable underlying kinds of fields with this unit.
+	kinds []reflect.Kind
+}
+
+var units = map[string]unit{
+	"bytes": {
+		parse:    parseBytes,
+		accepted: "accepted units: " + strings.Join(byteSuffixNames(), ", "),
+		kinds: []reflect.Kind{
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64,
+		},
+	},
+	"percent": {
+		parse:    parsePercent,
+		accepted: `accepted units: % (as in "75%")`,
+		kinds:    []reflect.Kind{reflect.Float32, reflect.Float64},
+	},
+}
+
+var byteSuffixes = []struct {
+	suffix string
+	mult   int64
+}{
+	// Longest suffixes first, so that KiB is not mistaken for B.
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40}, {"PiB", 1 << 50}, {"EiB", 1 << 60},
+	{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"PB", 1e15}, {"EB", 1e18},
+	{"B", 1},
+}
+
+func byteSuffixNames() []string {
+	names := make([]string, len(byteSuffixes))
+	for i, s := range byteSuffixes {
+		names[i] = s.suffix
+	}
+	return names
+}
+
+// parseBytes parses a byte size such as "64MiB" or "1.5GB".
+// The result must be a whole number of bytes.
+func parseBytes(s string) (any, bool) {
+	num, mult := strings.TrimSpace(s), int64(1)
+	for _, suf := range byteSuffixes {
+		if strings.HasSuffix(num, suf.suffix) {
+			num, mult = strings.TrimSpace(strings.TrimSuffix(num, suf.suffix)), suf.mult
+			break
+		}
+	}
+	// Use big.Rat to avoid float64 rounding errors for large sizes.
+	r, ok := new(big.Rat).SetString(num)
+	if !ok || r.Sign() < 0 {
+		return nil, false
+	}
+	r.Mul(r, new(big.Rat).SetInt64(mult))
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return nil, false
+	}
+	return r.Num().Int64(), true
+}
+
+// parsePercent parses a percentage such as "75%" as a ratio (0.75).
+func parsePercent(s string) (any, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasSuffix(s, "%") {
+		return nil, false
+	}
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(strings.TrimSuffix(s, "%")))
+	if !ok {
+		return nil, false
+	}
+	f, _ := r.Quo(r, big.NewRat(100, 1)).Float64()
+	return f, true
+}
+
+// checkUnit checks that unit name is known and can be used for field f.
+func checkUnit(f reflect.StructField, name string) error {
+	u, ok := units[name]
+	if !ok {
+		return fmt.Errorf("field %s: unknown tstruct unit %q", f.Name, name)
+	}
+	typ := f.Type
+	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if vt, ok := nullableValueType(typ); ok {
+		typ = vt
+	}
+	for _, k := range u.kinds {
+		if typ.Kind() == k {
+			return nil
+		}
+	}
+	return fmt.Errorf("field %s: tstruct unit %s cannot be used with type %v", f.Name, name, f.Type)
+}
+
+// applyUnit parses src according to the named unit, if src is a string,
+// for use as (part of) the value of the field named name, of type typ.
+// It panics if the parsed value does not fit in typ.
+// Other values are returned unchanged.
+func applyUnit(unitName, name string, src reflect.Value, typ reflect.Type) reflect.Value {
+	if unitName == "" || src.Kind() != reflect.String {
+		return src
+	}
+	u := units[unitName]
+	x, ok := u.parse(src.String())
+	if !ok {
+		panic(fmt.Sprintf("invalid %s %q for %s (%s)", unitName, src.String(), name, u.accepted))
+	}
+	if vt, ok := nullableValueType(typ); ok {
+		typ = vt
+	}
+	if r, ok := unitOverflow(x, typ); ok {
+		panic(fmt.Sprintf("%s %q overflows %s (%v, range %s)", unitName, src.String(), name, typ, r))
+	}
+	return reflect.ValueOf(x)
+}
+
+// unitOverflow reports whether x, a parsed int64 or float64, overflows the numeric type typ.
+// If so, it also returns a description of typ's range.
+func unitOverflow(x any, typ reflect.Type) (string, bool) {
+	z := reflect.Zero(typ)
+	switch x := x.(type) {
+	case int64:
+		switch {
+		case z.CanInt() && z.OverflowInt(x):
+			max := int64(^uint64(0) >> (65 - typ.Bits()))
+			return fmt.Sprintf("%d to %d", -max-1, max), true
+		case z.CanUint() && (x < 0 || z.OverflowUint(uint64(x))):
+			return fmt.Sprintf("0 to %d", ^uint64(0)>>(64-typ.Bits())), true
+		}
+	case float64:
+		if z.CanFloat() && z.OverflowFloat(x) {
+			return fmt.Sprintf("±%g", maxFloat(typ.Bits())), true
+		}
+	}
+	return "", false
+}
+
+func maxFloat(bits int) float64 {
+	if bits == 32 {
+		return math.MaxFloat32
+	}
+	return math.MaxFloat64
+}
@@ -0,0 +1,79 @@
+package tstruct_test
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/josharian/tstruct"
+)
+
+type Limits struct {
+	MaxSize   int64            `tstruct:"unit=bytes"`
+	BufSize   uint32           `tstruct:"unit=bytes,pos=0"`
+	Threshold float64          `tstruct:"unit=percent"`
+	Sizes     []int            `tstruct:"unit=bytes"`
+	Quotas    map[string]int64 `tstruct:"unit=bytes"`
+}
+
+func TestUnits(t *testing.T) {
+	want := Limits{
+		MaxSize:   64 << 20,
+		BufSize:   4096,
+		Threshold: 0.75,
+		Sizes:     []int{1500000000, 512, 100},
+		Quotas:    map[string]int64{"a": 2000},
+	}
+	const tmpl = `
+{{ yield
+	(Limits "4KiB"
+		(MaxSize "64MiB")
+		(Threshold "75%")
+		(Sizes "1.5GB" "512 B" 100)
+		(Quotas "a" "2kB")
+	)
+}}
+`
+	testOne(t, want, tmpl)
+	// Plain numbers still work.
+	testOne(t, Limits{MaxSize: 10, Threshold: 0.5}, `{{ yield (Limits (MaxSize 10) (Threshold 0.5)) }}`)
+}
+
+func TestUnitsErrors(t *testing.T) {
+	testOneWantErrStrs(t, Limits{}, `{{ yield (Limits (MaxSize "64XB")) }}`, []string{"MaxSize", `"64XB"`, "KiB, MiB"})
+	testOneWantErrStrs(t, Limits{}, `{{ yield (Limits (MaxSize "1.5B")) }}`, []string{"MaxSize"})
+	testOneWantErrStrs(t, Limits{}, `{{ yield (Limits (Threshold "75")) }}`, []string{"Threshold", "accepted units: %"})
+	testOneWantErrStrs(t, Limits{}, `{{ yield (Limits "x") }}`, []string{"BufSize"})
+
+	// Parsed sizes must fit in the field's type.
+	type Small struct {
+		Mem    uint32           `tstruct:"unit=bytes"`
+		Tiny   int8             `tstruct:"unit=bytes"`
+		Counts []uint8          `tstruct:"unit=bytes"`
+		Quota  map[string]int16 `tstruct:"unit=bytes"`
+		Ratio  float32          `tstruct:"unit=percent"`
+	}
+	testOneWantErrStrs(t, Small{}, `{{ yield (Small (Mem "8GiB")) }}`, []string{`bytes "8GiB" overflows Mem`, "range 0 to 4294967295"})
+	testOneWantErrStrs(t, Small{}, `{{ yield (Small (Tiny "1KiB")) }}`, []string{`bytes "1KiB" overflows Tiny`, "range -128 to 127"})
+	testOneWantErrStrs(t, Small{}, `{{ yield (Small (Counts "1B" "256B")) }}`, []string{"overflows Counts", "range 0 to 255"})
+	testOneWantErrStrs(t, Small{}, `{{ yield (Small (Quota "a" "1MB")) }}`, []string{"overflows Quota", "range -32768 to 32767"})
+	testOneWantErrStrs(t, Small{}, `{{ yield (Small (Ratio "1e50%")) }}`, []string{"overflows Ratio"})
+	testOneWantErrStrs(t, Limits{}, `{{ yield (Limits "5GiB") }}`, []string{"overflows BufSize"})
+	testOne(t, Small{Mem: 4<<30 - 1, Tiny: 127}, `{{ yield (Small (Mem "4294967295B") (Tiny "127B")) }}`)
+
+	type BadUnit struct {
+		X int `tstruct:"unit=furlongs"`
+	}
+	type BadKind struct {
+		X int `tstruct:"unit=percent"`
+	}
+	for _, add := range []func(map[string]any, ...tstruct.Option) error{
+		tstruct.AddFuncMap[BadUnit],
+		tstruct.AddFuncMap[BadKind],
+	} {
+		m := make(template.FuncMap)
+		err := add(m)
+		if err == nil {
+			t.Errorf("expected error, got %#v", m)
+		}
+	}
+}